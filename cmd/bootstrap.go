@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/DataDrake/waterlog"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/spf13/cobra"
+	"github.com/yourbasic/graph"
+)
+
+var (
+	deferKinds []string
+
+	cmdBootstrap = &cobra.Command{
+		Use:   "bootstrap [src|bin|dir|repo|overlay:path] [names/providers]",
+		Short: "Plan building the given source recipes and all their dependencies from scratch",
+		Long: `Plan building the given source recipes, and everything they depend on, from
+scratch, e.g. when bootstrapping a new repository.
+
+For example: autobuild bootstrap --defer-kind pkgconfig32 src:../packages glibc
+
+Unlike query, cycles don't make it fail as long as they can be broken. A
+package in a cycle can be built in stage1 without the build dependencies that
+match the "solver.stage1" regexes in its autobuild.yaml, or that are of one of
+the provider kinds given by --defer-kind. It is then rebuilt (stage2) once the
+rest of the cycle is built.
+
+When no names are passed, it plans building all the packages it can find.`,
+		Run: runBootstrap,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("expects one arg for path to binary index or source repo")
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	cmdBootstrap.Flags().StringSliceVar(&deferKinds, "defer-kind", nil, "provider kinds (e.g. pkgconfig32) that can be left out of a stage1 build of any package")
+	cmdBootstrap.Flags().BoolVar(&showSub, "show-sub", false, "show the subpackages that a node represents instead of just the recipe name")
+}
+
+func runBootstrap(cmd *cobra.Command, args []string) {
+	tpath := args[0]
+
+	state, err := st.LoadState(tpath, fallbackState)
+	if err != nil {
+		waterlog.Fatalf("Failed to parse state: %s\n", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	depGraph := state.DepGraph()
+	chosen := make(map[int]bool)
+	if len(args) < 2 {
+		waterlog.Infoln("No packages are provided, will plan building all packages")
+		for idx := range state.Packages() {
+			chosen[idx] = true
+		}
+	} else {
+		revGraph := graph.Sort(graph.Transpose(depGraph))
+		queries := slices.Clone(args[1:])
+		slices.Sort(queries)
+		for _, query := range utils.Uniq2(queries) {
+			ids, err := queryIds(state, query)
+			if err != nil {
+				waterlog.Fatalf("Failed to plan bootstrap: %s\n", err)
+			}
+
+			for _, idx := range ids {
+				utils.BFSWithDepth(revGraph, idx, func(node int, _ int) bool {
+					chosen[node] = true
+					return false
+				})
+			}
+		}
+	}
+
+	steps, err := st.BootstrapOrder(state, func(i int) bool { return chosen[i] }, deferKinds)
+	if err != nil {
+		if qerr, ok := err.(st.QueryHasCyclesErr); ok {
+			printCycles(qerr)
+			waterlog.Errorln("Consider configuring stage1 dependencies for some of the packages above.")
+		}
+		waterlog.Fatalf("Failed to plan bootstrap: %s\n", err)
+	}
+
+	stage1 := 0
+	waterlog.Goodln("Bootstrap plan:")
+	for stepIdx, step := range steps {
+		if step.Stage == 1 {
+			stage1++
+		}
+		fmt.Printf("%d. %s\n", stepIdx+1, step.Show(showSub, true))
+	}
+	waterlog.Goodf("%d builds in total, %d packages built in stage1\n", len(steps), stage1)
+}
@@ -4,13 +4,24 @@
 
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/config"
+	"github.com/GZGavinZhao/autobuild/push"
+	"github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
 
 var (
-	quiet       bool
-	verbose     bool
-	sourcesPath string
-	indexPath   string
+	quiet         bool
+	verbose       bool
+	configPath    string
+	globalCfg     config.GlobalConfig
+	backendKind   string
+	fallback      string
+	fallbackState state.State
+	sourcesPath   string
+	indexPath     string
 )
 
 func pathsInit(cmd *cobra.Command) {
@@ -19,3 +30,24 @@ func pathsInit(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&indexPath, "index", "i", "", "path to the eopkg binary index to compare against")
 	cmd.MarkFlagRequired("index")
 }
+
+// backendConfig returns the config of the build backend from the global
+// config, with the kind given by --backend.
+func backendConfig() (cfg config.BackendConfig) {
+	cfg = globalCfg.Backend
+	if len(backendKind) > 0 {
+		cfg.Kind = backendKind
+	}
+	return cfg.WithDefaults()
+}
+
+// setupBackend returns the build backend from the global config, or of the
+// kind given by --backend.
+func setupBackend() (backend push.Backend, cfg config.BackendConfig) {
+	cfg = backendConfig()
+	backend, err := push.NewBackend(cfg)
+	if err != nil {
+		waterlog.Fatalf("Failed to set up build backend: %s\n", err)
+	}
+	return
+}
@@ -14,7 +14,7 @@ var (
 	strictDiff bool
 
 	cmdDiff = &cobra.Command{
-		Use:   "diff <[src|bin|repo]:path-to-old> <[src|bin|repo]:path-to-new>",
+		Use:   "diff <[src|bin|dir|repo|overlay]:path-to-old> <[src|bin|dir|repo|overlay]:path-to-new>",
 		Short: "Diff the packages between binary indices or sources or a mix of them",
 		Run:   runDiff,
 		Args:  cobra.ExactArgs(2),
@@ -31,13 +31,13 @@ func runDiff(cmd *cobra.Command, args []string) {
 
 	var oldState, newState state.State
 
-	oldState, err := state.LoadState(oldTPath)
+	oldState, err := state.LoadState(oldTPath, fallbackState)
 	if err != nil {
 		waterlog.Fatalf("Failed to load old state %s: %s\n", oldTPath, err)
 	}
 	waterlog.Goodln("Successfully parsed old state!")
 
-	newState, err = state.LoadState(newTPath)
+	newState, err = state.LoadState(newTPath, fallbackState)
 	if err != nil {
 		waterlog.Fatalf("Failed to load new state %s: %s\n", newTPath, err)
 	}
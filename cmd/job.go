@@ -0,0 +1,228 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/progress"
+	"github.com/GZGavinZhao/autobuild/push"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdJob = &cobra.Command{
+		Use:   "job",
+		Short: "Manage jobs on the build backend",
+		Long: `Inspect, watch and cancel jobs on the build backend without raw ssh.
+
+The backend is taken from the global config, or given with --backend. Note
+that the jobs of the local and fake backends only live as long as the push
+that submitted them.`,
+	}
+
+	cmdJobStatus = &cobra.Command{
+		Use:   "status <ids>",
+		Short: "Show the status of the given jobs",
+		Run:   runJobStatus,
+		Args:  jobIdArgs(1, -1),
+	}
+
+	cmdJobWatch = &cobra.Command{
+		Use:   "watch <id>",
+		Short: "Follow the status of a job until it's done",
+		Run:   runJobWatch,
+		Args:  jobIdArgs(1, 1),
+	}
+
+	cmdJobCancel = &cobra.Command{
+		Use:   "cancel <ids>",
+		Short: "Cancel the given jobs",
+		Run:   runJobCancel,
+		Args:  jobIdArgs(1, -1),
+	}
+
+	cmdJobList = &cobra.Command{
+		Use:   "list",
+		Short: "List the jobs on the build backend",
+		Run:   runJobList,
+		Args:  cobra.NoArgs,
+	}
+)
+
+func init() {
+	cmdJob.PersistentFlags().StringVar(&backendKind, "backend", "", "build backend to manage jobs of (ssh, local or fake), overriding the global config")
+	cmdJobList.Flags().Bool("mine", false, "only list the jobs submitted by autobuild push")
+
+	cmdJob.AddCommand(cmdJobStatus)
+	cmdJob.AddCommand(cmdJobWatch)
+	cmdJob.AddCommand(cmdJobCancel)
+	cmdJob.AddCommand(cmdJobList)
+}
+
+// jobIdArgs validates that between `min` and `max` job IDs are passed. A
+// negative `max` means no limit.
+func jobIdArgs(min int, max int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) < min {
+			return errors.New("expects at least one job ID")
+		} else if max >= 0 && len(args) > max {
+			return fmt.Errorf("expects at most %d job IDs", max)
+		}
+
+		_, err := parseJobIds(args)
+		return err
+	}
+}
+
+func parseJobIds(args []string) (ids []int, err error) {
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid job ID %s", arg)
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+func runJobStatus(cmd *cobra.Command, args []string) {
+	ids, _ := parseJobIds(args)
+	backend, _ := setupBackend()
+
+	failed := false
+	for _, id := range ids {
+		job, err := backend.Query(id)
+		if err != nil {
+			failed = true
+			waterlog.Errorf("Failed to query job %d: %s\n", id, err)
+			continue
+		}
+		fmt.Println(showJob(job))
+	}
+
+	if failed {
+		waterlog.Fatalln("Failed to query some jobs")
+	}
+}
+
+func runJobWatch(cmd *cobra.Command, args []string) {
+	ids, _ := parseJobIds(args)
+	backend, backendCfg := setupBackend()
+
+	job, err := backend.Query(ids[0])
+	if err != nil {
+		waterlog.Fatalf("Failed to query job %d: %s\n", ids[0], err)
+	}
+
+	board := progress.NewBoard()
+	board.Set(fmt.Sprint(job.ID), showJob(job))
+	job, err = push.NewPoller(backend, backendCfg).Wait(job, func(job push.Job) {
+		board.Set(fmt.Sprint(job.ID), showJob(job))
+	})
+	board.Done()
+	if err != nil {
+		waterlog.Fatalf("Failed to watch job %d: %s\n", ids[0], err)
+	}
+
+	if job.Status != push.StatusOK {
+		waterlog.Fatalf("Job %d finished with status %s\n", job.ID, job.Status)
+	}
+	waterlog.Goodf("Job %d built successfully\n", job.ID)
+}
+
+func runJobCancel(cmd *cobra.Command, args []string) {
+	ids, _ := parseJobIds(args)
+	backend, _ := setupBackend()
+
+	failed := false
+	for _, id := range ids {
+		if err := backend.Cancel(id); err != nil {
+			failed = true
+			waterlog.Errorf("Failed to cancel job %d: %s\n", id, err)
+			continue
+		}
+		waterlog.Goodf("Cancelled job %d\n", id)
+	}
+
+	if failed {
+		waterlog.Fatalln("Failed to cancel some jobs")
+	}
+}
+
+func runJobList(cmd *cobra.Command, args []string) {
+	mine, _ := cmd.Flags().GetBool("mine")
+	backend, backendCfg := setupBackend()
+
+	jobs, err := backend.List()
+	if err != nil {
+		waterlog.Fatalf("Failed to list jobs: %s\n", err)
+	}
+
+	if mine {
+		submitted, err := submittedJobs(backendCfg.Kind)
+		if err != nil {
+			waterlog.Fatalf("Failed to read push sessions: %s\n", err)
+		}
+
+		var filtered []push.Job
+		for _, job := range jobs {
+			if submitted[job.ID] {
+				filtered = append(filtered, job)
+			}
+		}
+		jobs = filtered
+	}
+
+	if len(jobs) == 0 {
+		waterlog.Infoln("No jobs found")
+		return
+	}
+	for _, job := range jobs {
+		fmt.Println(showJob(job))
+	}
+}
+
+// submittedJobs returns the IDs of the jobs recorded in the push sessions that
+// published to the `kind` kind of backend. Only the ssh backend keeps its jobs
+// across runs, so the IDs of other backends never match.
+func submittedJobs(kind string) (ids map[int]bool, err error) {
+	ids = make(map[int]bool)
+	if kind != "ssh" {
+		return
+	}
+
+	journals, err := push.ListSessions()
+	if err != nil {
+		return
+	}
+	for _, journal := range journals {
+		if journal.Backend != kind {
+			continue
+		}
+		for _, entry := range journal.Entries {
+			if entry.Job != nil {
+				ids[entry.Job.ID] = true
+			}
+		}
+	}
+	return
+}
+
+func showJob(job push.Job) string {
+	builder := job.Builder
+	if len(builder) == 0 {
+		builder = "-"
+	}
+	finished := ""
+	if job.Finished != nil {
+		finished = " finished " + job.Finished.Local().Format(time.DateTime)
+	}
+	return fmt.Sprintf("%d\t%s\t%s\t%s%s", job.ID, job.Tag, job.Status, builder, finished)
+}
@@ -5,15 +5,27 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
 	"github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/progress"
+	"github.com/GZGavinZhao/autobuild/push"
 	"github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/stats"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
 var (
 	cmdPush = &cobra.Command{
-		Use:   "push <[src|bin|repo]:path-to-old> <[src|bin|repo]:path-to-new> <packages-to-push>",
+		Use:   "push <[src|bin|dir|repo|overlay]:path-to-old> <[src|bin|dir|repo|overlay]:path-to-new> <packages-to-push>",
 		Short: "Push package changes to the build server",
 		Long: `Essentially the same as query, but also push the packages to the build server.
 
@@ -23,8 +35,20 @@ push the packages that are passed.
 
 If you get a cycles output, query the build order of those packages with 
 autobuild query to get a more detailed output on the cycle.
+
+Every push is recorded in a session with the planned order and the jobs that
+were published. If a push is interrupted or a build fails, resume it with
+--resume <session>: packages that were built are skipped, jobs still in flight
+are waited for, and the rest are published. Local builds don't outlive the push
+that started them, so with the local backend the jobs in flight are built again.
 `,
 		Run: runPush,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if session, _ := cmd.Flags().GetString("resume"); len(session) == 0 && len(args) < 2 {
+				return errors.New("expects the old and new tpaths")
+			}
+			return nil
+		},
 	}
 )
 
@@ -32,21 +56,31 @@ func init() {
 	cmdPush.Flags().BoolP("force", "f", false, "whether to ignore safety checks")
 	cmdPush.Flags().BoolP("dry-run", "n", true, "don't publish anything")
 	cmdPush.Flags().BoolP("push", "p", true, "git push packages before publishing")
+	cmdPush.Flags().StringVar(&backendKind, "backend", "", "build backend to publish to (ssh, local or fake), overriding the global config")
+	cmdPush.Flags().String("resume", "", "resume the given push session instead of starting a new one")
+	cmdPush.Flags().BoolP("keep-going", "k", false, "keep publishing the packages that don't depend on failed ones")
+	cmdPush.Flags().IntP("jobs", "j", 4, "maximum number of packages of a tier to publish at the same time, always 1 with the local backend")
+	cmdPush.Flags().StringVar(&statsPath, "stats", stats.DefaultPath(), "path to the build duration stats file to record builds in")
 }
 
 func runPush(cmd *cobra.Command, args []string) {
+	if session, _ := cmd.Flags().GetString("resume"); len(session) > 0 {
+		resumePush(cmd, session)
+		return
+	}
+
 	oldTPath := args[0]
 	newTPath := args[1]
 
 	var oldState, newState state.State
 
-	oldState, err := state.LoadState(oldTPath)
+	oldState, err := state.LoadState(oldTPath, fallbackState)
 	if err != nil {
 		waterlog.Fatalf("Failed to load old state %s: %s\n", oldTPath, err)
 	}
 	waterlog.Goodln("Successfully parsed old state!")
 
-	newState, err = state.LoadState(newTPath)
+	newState, err = state.LoadState(newTPath, fallbackState)
 	if err != nil {
 		waterlog.Fatalf("Failed to load new state %s: %s\n", newTPath, err)
 	}
@@ -90,7 +124,10 @@ func runPush(cmd *cobra.Command, args []string) {
 			waterlog.Warnf("Package %s hasn't changed, skipping...\n", pkg.Source)
 		} else if diff.IsNewRel() {
 			bumped = append(bumped, pkg)
-			bset[diff.Idx] = true
+			// All the split nodes of the source are rebuilt
+			for _, idx := range state.GetSourceIds(newState, pkg.Source) {
+				bset[idx] = true
+			}
 		} else if diff.IsSameRel() && !diff.IsSame() {
 			bad = append(bad, pkg)
 		} else if diff.IsDowngrade() {
@@ -98,163 +135,392 @@ func runPush(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	// force, _ := cmd.Flags().GetBool("force")
-	// dryRun, _ := cmd.Flags().GetBool("dry-run")
-	// prePush, _ := cmd.Flags().GetBool("push")
-
-	//if len(bad) != 0 {
-	//	waterlog.Warnf("The following packages have the same release number but different version:")
-	//	for _, pkg := range bad {
-	//		waterlog.Printf(" %s", pkg.Name)
-	//	}
-	//	waterlog.Println()
-	//	if !force {
-	//		os.Exit(1)
-	//	}
-	//}
-
-	//if len(outdated) != 0 {
-	//	waterlog.Warnf("The following packages have older release numbers:")
-	//	for _, pkg := range outdated {
-	//		waterlog.Printf(" %s", pkg.Name)
-	//	}
-	//	waterlog.Println()
-	//}
-
-	//if len(bumped) == 0 {
-	//	waterlog.Infoln("No packages to update. Exiting...")
-	//	return
-	//}
-
-	//// Check that the dependencies of every package already exist
-	//var unresolved []common.Package
-	//for _, pkg := range bumped {
-	//	// TODO: we should probably just be able to call pkg.Resolved?
-	//	if len(pkg.Resolve(newState.NameToSrcIdx(), newState.Packages())) > 0 {
-	//		unresolved = append(unresolved, pkg)
-	//	}
-	//}
-	//if len(unresolved) != 0 {
-	//	// waterlog.Errorf("The following packages have nonexistent build dependencies:")
-	//	waterlog.Errorln("The following packages have nonexistent build dependencies:")
-	//	for _, pkg := range unresolved {
-	//		// waterlog.Printf(" %s", pkg.Name)
-	//		waterlog.Errorf("%s:", pkg.Name)
-	//		for _, dep := range pkg.BuildDeps {
-	//			if _, ok := newState.NameToSrcIdx()[dep]; !ok {
-	//				waterlog.Printf(" %s", dep)
-	//			}
-	//		}
-	//		waterlog.Println()
-	//	}
-
-	//	// waterlog.Println()
-	//	if !force {
-	//		os.Exit(1)
-	//	}
-	//}
-
-	//waterlog.Goodf("The following packages will be updated:")
-	//for _, pkg := range bumped {
-	//	waterlog.Printf(" %s", pkg.Name)
-	//}
-	//waterlog.Println()
-
-	//depGraph := newState.DepGraph()
-	//waterlog.Goodln("Successfully generated dependency graph!")
-
-	//lifted := utils.LiftGraph(depGraph, func(i int) bool { return bset[i] })
-	//if err != nil {
-	//	waterlog.Fatalf("Failed to lift updated packages from dependency graph: %s\n", err)
-	//}
-	//waterlog.Goodln("Successfully isolated packages to update!")
-
-	//res, ok := utils.TieredTopSort(lifted)
-	//order := utils.Filter(utils.Flatten(res), func(i int) bool { return bset[i] })
-	//if !ok {
-	//	cycles := utils.Filter(graph.StrongComponents(lifted), func(i []int) bool { return len(i) > 1 })
-	//	cycleIdx := 0
-
-	//	for _, cycle := range cycles {
-	//		if len(cycle) <= 1 {
-	//			continue
-	//		}
-
-	//		waterlog.Warnf("Cycle %d:", cycleIdx+1)
-	//		cycleIdx++
-
-	//		for _, nodeIdx := range cycle {
-	//			waterlog.Printf(" %s", newState.Packages()[nodeIdx].Name)
-	//		}
-	//		waterlog.Println()
-	//	}
-	//	waterlog.Fatalln("Failed to compute build order: lifted graph has cycles! Run `autobuild query` on the cycle to get more info.")
-	//}
-
-	//waterlog.Goodln("Here's the build order:")
-	//for _, idx := range order {
-	//	waterlog.Println(newState.Packages()[idx].Name)
-	//}
-
-	//if dryRun {
-	//	return
-	//}
-
-	//red := color.New(color.FgRed).SprintFunc()
-	//green := color.New(color.FgGreen).SprintFunc()
-	//for _, idx := range order {
-	//	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
-	//	defer s.Stop()
-	//	pkg := newState.Packages()[idx]
-
-	//	s.Prefix = " "
-	//	s.Suffix = fmt.Sprintf("  Publishing %s", pkg.Name)
-	//	s.Color("white")
-	//	s.Restart()
-
-	//	job, err := push.Publish(pkg, prePush)
-	//	jobid := job.ID
-	//	if err != nil {
-	//		s.FinalMSG = fmt.Sprintf("%s failed to publish %s: %s", red("[x]"), pkg.Name, err)
-	//		s.Stop()
-	//		os.Exit(1)
-	//	}
-
-	//	s.Color("yellow")
-	//	s.Suffix = fmt.Sprintf("  Package %s (%d) is waiting to be claimed", pkg.Name, jobid)
-	//	s.Restart()
-	//	for job.Status == "UNCLAIMED" {
-	//		job, err = push.Query(jobid)
-	//		time.Sleep(1 * time.Second)
-	//	}
-
-	//	s.Suffix = fmt.Sprintf("  Package %s (%d) is claimed, waiting to be built", pkg.Name, jobid)
-	//	for job.Status == "CLAIMED" {
-	//		job, err = push.Query(jobid)
-	//		time.Sleep(1 * time.Second)
-	//	}
-
-	//	if job.Status == "BUILDING" {
-	//		s.Color("green")
-	//		s.Suffix = fmt.Sprintf("  Package %s (%d) is building", pkg.Name, jobid)
-	//		s.Restart()
-	//	}
-	//	for job.Status == "BUILDING" {
-	//		job, err = push.Query(jobid)
-	//		time.Sleep(15 * time.Second)
-	//	}
-
-	//	if job.Status == "OK" {
-	//		s.FinalMSG = fmt.Sprintf("%s %s (%d) built successfully!\n", green("[✓]"), pkg.Name, jobid)
-	//		s.Stop()
-	//	} else {
-	//		if job.Status == "FAILED" {
-	//			s.FinalMSG = fmt.Sprintf("%s %s (%d) failed to build\n", red("[x]"), pkg.Name, jobid)
-	//		} else {
-	//			s.FinalMSG = fmt.Sprintf("%s %s (%d) has unknown status %s\n", red("[x]"), pkg.Name, jobid, job.Status)
-	//		}
-	//		s.Stop()
-	//		os.Exit(1)
-	//	}
-	//}
+	force, _ := cmd.Flags().GetBool("force")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	if len(bad) != 0 {
+		waterlog.Warnf("The following packages have the same release number but different version:")
+		for _, pkg := range bad {
+			waterlog.Printf(" %s", pkg.Source)
+		}
+		waterlog.Println()
+		if !force {
+			os.Exit(1)
+		}
+	}
+
+	if len(outdated) != 0 {
+		waterlog.Warnf("The following packages have older release numbers:")
+		for _, pkg := range outdated {
+			waterlog.Printf(" %s", pkg.Source)
+		}
+		waterlog.Println()
+	}
+
+	if len(bumped) == 0 {
+		waterlog.Infoln("No packages to update. Exiting...")
+		return
+	}
+
+	// Check that the dependencies of every package already exist
+	if srcState, ok := newState.(*state.SourceState); ok {
+		unresolved := false
+		for idx, deps := range srcState.Unresolved() {
+			if bset[idx] {
+				unresolved = true
+				waterlog.Errorf("%s has nonexistent build dependencies: %s\n", newState.Packages()[idx].Source, strings.Join(deps, " "))
+			}
+		}
+		if unresolved && !force {
+			os.Exit(1)
+		}
+	}
+
+	waterlog.Goodf("The following packages will be updated:")
+	for _, pkg := range bumped {
+		waterlog.Printf(" %s", pkg.Source)
+	}
+	waterlog.Println()
+
+	order, err := state.QueryOrder(newState, func(i int) bool { return bset[i] })
+	if err != nil {
+		if qerr, ok := err.(state.QueryHasCyclesErr); ok {
+			printCycles(qerr)
+		}
+		waterlog.Fatalf("Failed to compute build order: %s. Run `autobuild query` on the cycle to get more info.\n", err)
+	}
+
+	order, warnings := push.PlanSources(newState, order)
+	for _, warning := range warnings {
+		waterlog.Warnln(warning)
+	}
+
+	waterlog.Goodln("Here's the build order:")
+	for tierIdx, tier := range order {
+		waterlog.Goodf("Tier %d: ", tierIdx+1)
+		for _, pkg := range tier {
+			fmt.Printf("%s ", pkg.Source)
+		}
+		fmt.Println()
+	}
+
+	if dryRun {
+		return
+	}
+
+	journal, err := push.NewJournal(oldTPath, newTPath, backendConfig().Kind, order)
+	if err != nil {
+		waterlog.Fatalf("Failed to create push session: %s\n", err)
+	}
+	waterlog.Infof("Started push session %s, resume it with `autobuild push --resume %s` if interrupted\n", journal.Session, journal.Session)
+
+	publishOrder(cmd, newState, order, journal)
+}
+
+// resumePush continues the push session `session` where it left off.
+func resumePush(cmd *cobra.Command, session string) {
+	journal, err := push.LoadJournal(session)
+	if err != nil {
+		waterlog.Fatalf("Failed to load push session: %s\n", err)
+	}
+	if kind := backendConfig().Kind; len(journal.Backend) > 0 && journal.Backend != kind {
+		waterlog.Fatalf("Push session %s published to the %s backend, not %s, resume it with --backend %s\n", session, journal.Backend, kind, journal.Backend)
+	}
+
+	newState, err := state.LoadState(journal.NewTPath, fallbackState)
+	if err != nil {
+		waterlog.Fatalf("Failed to load new state %s: %s\n", journal.NewTPath, err)
+	}
+	waterlog.Goodln("Successfully parsed new state!")
+
+	order, err := journal.Order(newState.Packages())
+	if err != nil {
+		waterlog.Fatalf("Failed to resume push session: %s\n", err)
+	}
+
+	waterlog.Goodf("Resuming push session %s\n", session)
+	for _, entry := range journal.Entries {
+		if entry.Job == nil {
+			continue
+		}
+		waterlog.Infof("%s was published as job %d with status %s\n", entry.Source, entry.Job.ID, entry.Job.Status)
+	}
+
+	publishOrder(cmd, newState, order, journal)
+}
+
+// publishOrder publishes the tiers of `order`, which are packages of
+// `newState`, one after another, recording the progress in `journal`.
+func publishOrder(cmd *cobra.Command, newState state.State, order [][]common.Package, journal *push.Journal) {
+	prePush, _ := cmd.Flags().GetBool("push")
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	keepGoing, _ := cmd.Flags().GetBool("keep-going")
+	force, _ := cmd.Flags().GetBool("force")
+
+	backend, backendCfg := setupBackend()
+	previous := journal.Previous
+	if local, ok := backend.(*push.LocalBackend); ok {
+		local.LogDir = filepath.Join(journal.Dir(), "logs")
+
+		// solbuild and boulder each take over the whole machine, so local
+		// builds can't run side by side
+		if jobs != 1 && cmd.Flags().Changed("jobs") {
+			waterlog.Warnf("Ignoring --jobs %d, the local backend builds one package at a time\n", jobs)
+		}
+		jobs = 1
+
+		// Local builds die with the push that started them, and their job
+		// IDs start over in every push, so the ones that were still in
+		// flight are built again instead of being waited for
+		previous = func(pkg common.Package) (res push.Result, ok bool) {
+			if res, ok = journal.Previous(pkg); ok && !res.Job.IsDone() {
+				ok = false
+			}
+			return
+		}
+	}
+
+	// Every backend builds the recipes as they are committed
+	preflight(push.Preflight(utils.Flatten(order)), force)
+
+	if backendCfg.Kind == "ssh" {
+		if prePush {
+			roots := make(map[string]bool)
+			for _, pkg := range utils.Flatten(order) {
+				if roots[pkg.Root] {
+					continue
+				}
+				roots[pkg.Root] = true
+
+				res, err := push.GitPush(pkg.Root)
+				if err != nil {
+					waterlog.Fatalf("Failed to push %s: %s\n", pkg.Root, err)
+				}
+				if len(res.Updated) == 0 {
+					waterlog.Infof("%s is already up to date with %s\n", pkg.Root, res.Remote)
+				}
+				for _, update := range res.Updated {
+					waterlog.Goodf("Pushed %s to %s: %s\n", pkg.Root, res.Remote, update)
+				}
+			}
+		}
+
+		// The build server only sees what has been pushed
+		preflight(push.CheckUpstream(utils.Flatten(order)), force)
+	}
+
+	// Saving stats that failed to load would overwrite the stats file
+	buildStats, err := stats.Load(statsPath)
+	recordStats := err == nil
+	if !recordStats {
+		waterlog.Warnf("Failed to load build stats, not recording build durations: %s\n", err)
+	}
+
+	// Index the planned packages in newState to find what failures block
+	chosen := make(map[int]bool)
+	for _, pkg := range utils.Flatten(order) {
+		for _, idx := range state.NodesOf(newState, pkg) {
+			chosen[idx] = true
+		}
+	}
+	choose := func(i int) bool { return chosen[i] }
+
+	var succeeded, failed []common.Package
+	var failedIds []int
+	blocked := make(map[int]int)
+
+	for tierIdx, tier := range order {
+		if len(failedIds) > 0 {
+			blocked = state.Blocked(newState, choose, failedIds)
+			tier = utils.Filter(slices.Clone(tier), func(pkg common.Package) bool {
+				_, ok := blockedBy(newState, blocked, pkg)
+				return !ok
+			})
+		}
+		if len(tier) == 0 {
+			waterlog.Warnf("Skipping tier %d/%d, all of its packages are blocked\n", tierIdx+1, len(order))
+			continue
+		}
+		waterlog.Infof("Publishing tier %d/%d\n", tierIdx+1, len(order))
+
+		board := progress.NewBoard()
+		publisher := push.Publisher{
+			Backend: backend,
+			Jobs:    jobs,
+			Poller:  push.NewPoller(backend, backendCfg),
+			OnUpdate: func(res push.Result) {
+				board.Set(res.Package.Source, showResult(res))
+				if err := journal.Record(res); err != nil {
+					waterlog.Warnf("Failed to update journal of session %s: %s\n", journal.Session, err)
+				}
+			},
+			Previous: previous,
+		}
+		results, err := publisher.PublishTier(tier)
+		board.Done()
+		if err != nil {
+			waterlog.Fatalf("Failed to finish tier %d: %s\n", tierIdx+1, err)
+		}
+
+		tierFailed := false
+		for _, res := range results {
+			if !res.OK() {
+				tierFailed = true
+				failed = append(failed, res.Package)
+				failedIds = append(failedIds, state.NodesOf(newState, res.Package)...)
+				waterlog.Errorf("Failed to publish %s: %s\n", res.Package.Source, res.Err)
+				if res.Job.Status == push.StatusFailed {
+					showBuildLog(backend, journal, res)
+				}
+				continue
+			}
+
+			succeeded = append(succeeded, res.Package)
+			if recordStats && !res.Skipped {
+				buildStats.RecordJob(res.Package.Source, res.Started, res.Job.Finished)
+			}
+		}
+
+		if recordStats {
+			if err := buildStats.Save(statsPath); err != nil {
+				waterlog.Warnf("Failed to save build stats: %s\n", err)
+			}
+		}
+		if tierFailed && !keepGoing {
+			showBlocked(newState, order, failedIds, state.Blocked(newState, choose, failedIds))
+			waterlog.Fatalf("Resume with `autobuild push --resume %s` once the failures are fixed\n", journal.Session)
+		}
+	}
+
+	if len(failed) == 0 {
+		waterlog.Goodln("All packages are built successfully!")
+		return
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	waterlog.Infoln("Summary of the push:")
+	fmt.Printf("%s %d built:", green("[✓]"), len(succeeded))
+	for _, pkg := range succeeded {
+		fmt.Printf(" %s", pkg.Source)
+	}
+	fmt.Println()
+	fmt.Printf("%s %d failed:", red("[x]"), len(failed))
+	for _, pkg := range failed {
+		fmt.Printf(" %s", pkg.Source)
+	}
+	fmt.Println()
+	showBlocked(newState, order, failedIds, blocked)
+
+	waterlog.Fatalf("Resume with `autobuild push --resume %s` once the failures are fixed\n", journal.Session)
+}
+
+// preflight stops the push if `err` of the pre-flight checks is not nil, or
+// only warns about it with `force`.
+func preflight(err error, force bool) {
+	if err != nil && !force {
+		waterlog.Fatalf("%s\nFix them or pass --force to publish anyway\n", err)
+	} else if err != nil {
+		waterlog.Warnf("%s\n", err)
+	}
+}
+
+// showBuildLog saves the build log of the failed job of `res` in the session
+// of `journal`, unless it's already there, and prints a summary of it.
+func showBuildLog(backend push.Backend, journal *push.Journal, res push.Result) {
+	path := journal.LogPath(res.Package.Source, res.Job.ID)
+
+	log, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fetcher, ok := backend.(push.LogFetcher)
+		if !ok {
+			return
+		}
+
+		if log, err = fetcher.Log(res.Job.ID); err != nil {
+			waterlog.Warnf("Failed to fetch build log of %s: %s\n", res.Package.Source, err)
+			return
+		}
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			err = os.WriteFile(path, log, 0o644)
+		}
+	}
+	if err != nil {
+		waterlog.Warnf("Failed to save build log of %s: %s\n", res.Package.Source, err)
+	} else {
+		waterlog.Infof("Build log of %s saved to %s\n", res.Package.Source, path)
+	}
+
+	problems := push.Summarize(log, 10)
+	if len(problems) == 0 {
+		waterlog.Infof("No errors recognized in the build log of %s\n", res.Package.Source)
+		return
+	}
+
+	red := color.New(color.FgRed).SprintFunc()
+	waterlog.Infof("Last errors in the build log of %s:\n", res.Package.Source)
+	for _, problem := range problems {
+		fmt.Printf("  %s %s\n", red(fmt.Sprintf("[%s]", problem.Kind)), problem.Line)
+	}
+}
+
+// showBlocked prints the packages of `order` that can no longer be built
+// because they depend on the packages `failed`, see state.Blocked.
+func showBlocked(newState state.State, order [][]common.Package, failed []int, blocked map[int]int) {
+	if len(blocked) == 0 {
+		return
+	}
+
+	count := 0
+	byFailed := make(map[int][]string)
+	for _, pkg := range utils.Flatten(order) {
+		if root, ok := blockedBy(newState, blocked, pkg); ok {
+			count++
+			byFailed[root] = append(byFailed[root], pkg.Source)
+		}
+	}
+
+	yellow := color.New(color.FgYellow).SprintFunc()
+	fmt.Printf("%s %d blocked:\n", yellow("[-]"), count)
+	for _, root := range failed {
+		if sources := byFailed[root]; len(sources) > 0 {
+			fmt.Printf("    by %s: %s\n", newState.Packages()[root].Source, strings.Join(sources, " "))
+		}
+	}
+}
+
+// blockedBy returns the failed node that blocks `pkg`, if any of its nodes is
+// blocked, see state.Blocked.
+func blockedBy(newState state.State, blocked map[int]int, pkg common.Package) (root int, ok bool) {
+	for _, idx := range state.NodesOf(newState, pkg) {
+		if root, ok = blocked[idx]; ok {
+			return
+		}
+	}
+	return
+}
+
+func showResult(res push.Result) string {
+	red := color.New(color.FgRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	switch {
+	case res.Err != nil && res.Job.ID == 0:
+		return fmt.Sprintf("%s %s failed to publish: %s", red("[x]"), res.Package.Source, res.Err)
+	case res.Job.Status == push.StatusOK:
+		return fmt.Sprintf("%s %s (%d) built successfully", green("[✓]"), res.Package.Source, res.Job.ID)
+	case res.Job.Status == push.StatusFailed:
+		return fmt.Sprintf("%s %s (%d) failed to build", red("[x]"), res.Package.Source, res.Job.ID)
+	case res.Err != nil:
+		return fmt.Sprintf("%s %s (%d): %s", red("[x]"), res.Package.Source, res.Job.ID, res.Err)
+	case res.Job.Status == push.StatusUnclaimed:
+		return fmt.Sprintf("%s %s (%d) is waiting to be claimed", yellow("[ ]"), res.Package.Source, res.Job.ID)
+	case res.Job.Status == push.StatusClaimed:
+		return fmt.Sprintf("%s %s (%d) is claimed, waiting to be built", yellow("[ ]"), res.Package.Source, res.Job.ID)
+	case res.Job.Status == push.StatusBuilding:
+		return fmt.Sprintf("%s %s (%d) is building", green("[~]"), res.Package.Source, res.Job.ID)
+	default:
+		return fmt.Sprintf("%s %s (%d) has unknown status %s", red("[?]"), res.Package.Source, res.Job.ID, res.Job.Status)
+	}
 }
@@ -7,10 +7,13 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/common"
 	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/stats"
 	"github.com/GZGavinZhao/autobuild/utils"
 	"github.com/spf13/cobra"
 	"github.com/yourbasic/graph"
@@ -24,8 +27,12 @@ var (
 	detailed bool
 	showSub  bool
 
+	builders        int
+	statsPath       string
+	defaultDuration time.Duration
+
 	cmdQuery = &cobra.Command{
-		Use:   "query [src|bin|repo:path] [names/providers]",
+		Use:   "query [src|bin|dir|repo|overlay:path] [names/providers]",
 		Short: "Query the build order of the given source recipes and providers",
 		Long: `Query the build order of the given source recipes or the source recipes that provide the given providers.
 
@@ -56,9 +63,27 @@ func init() {
 	// on the dependency chain with a different color?
 	cmdQuery.Flags().BoolVar(&detailed, "detailed", true, "report more detailed dependency chains during cycles output")
 	cmdQuery.Flags().BoolVar(&showSub, "show-sub", false, "show the subpackages that a node represents instead of just the recipe name")
+	cmdQuery.Flags().IntVarP(&builders, "builders", "b", 0, "schedule the build order for this many parallel builders using estimated build durations")
+	cmdQuery.Flags().StringVar(&statsPath, "stats", stats.DefaultPath(), "path to the build duration stats file used by --builders")
+	cmdQuery.Flags().DurationVar(&defaultDuration, "default-duration", 10*time.Minute, "build duration assumed for packages without stats")
+}
+
+// queryIds returns the nodes of the source recipe named `query`, or the node
+// that provides `query`.
+func queryIds(state st.State, query string) (ids []int, err error) {
+	if ids = st.GetSourceIds(state, query); len(ids) == 0 {
+		if _, idx := st.GetPackage(state, query); idx != -1 {
+			ids = append(ids, idx)
+		}
+	}
+
+	if len(ids) == 0 {
+		err = fmt.Errorf("Unable to find package or provider %s", query)
+	}
+	return
 }
 
-func execQuery(state st.State, queries []string) (res [][]common.Package, err error) {
+func execQuery(state st.State, queries []string) (res [][]common.Package, qset map[int]bool, err error) {
 	depGraph := state.DepGraph()
 	if depGraph == nil {
 		err = errors.New("Adjacency map for dependency graph is nil")
@@ -66,19 +91,11 @@ func execQuery(state st.State, queries []string) (res [][]common.Package, err er
 	}
 
 	revGraph := graph.Transpose(depGraph)
-	qset := map[int]bool{}
+	qset = map[int]bool{}
 
 	for _, query := range queries {
 		var ids []int
-
-		if ids = st.GetSourceIds(state, query); len(ids) == 0 {
-			if _, idx := st.GetPackage(state, query); idx != -1 {
-				ids = append(ids, idx)
-			}
-		}
-
-		if len(ids) == 0 {
-			err = fmt.Errorf("Unable to find package or provider %s", query)
+		if ids, err = queryIds(state, query); err != nil {
 			return
 		}
 
@@ -121,13 +138,14 @@ func execQuery(state st.State, queries []string) (res [][]common.Package, err er
 	// waterlog.Debugf("qset: %v\n", qset)
 	waterlog.Goodln("Found all requested packages in state!")
 
-	return st.QueryOrder(state, func(i int) bool { return qset[i] })
+	res, err = st.QueryOrder(state, func(i int) bool { return qset[i] })
+	return
 }
 
 func runQuery(cmd *cobra.Command, args []string) {
 	tpath := args[0]
 
-	state, err := st.LoadState(tpath)
+	state, err := st.LoadState(tpath, fallbackState)
 	if err != nil {
 		waterlog.Fatalf("Failed to parse state: %s\n", err)
 	}
@@ -145,28 +163,17 @@ func runQuery(cmd *cobra.Command, args []string) {
 	}
 	queries = utils.Uniq2(queries)
 
-	order, err := execQuery(state, queries)
+	order, qset, err := execQuery(state, queries)
 	if err != nil {
 		if qerr, ok := err.(st.QueryHasCyclesErr); ok {
-			waterlog.Errorln("Graph contains cycles:")
-			for cycleIdx, cycle := range qerr.Cycles {
-				waterlog.Errorf("Cycle %d: ", cycleIdx+1)
-				for _, pkg := range cycle.Members {
-					fmt.Printf("%s ", pkg.Show(showSub, true))
-				}
-				fmt.Println()
-
-				waterlog.Warnf("One of the dependency chains that led to this cycle: ")
-				for _, pkg := range cycle.Chain {
-					fmt.Printf("%s -> ", pkg.Show(showSub, true))
-				}
-				fmt.Println(cycle.Chain[0].Show(showSub, true))
-			}
+			printCycles(qerr)
 		}
 		waterlog.Fatalf("Failed to query order: %s\n", err)
 	}
 
-	if tiers {
+	if builders > 0 {
+		printSchedule(state, qset)
+	} else if tiers {
 		for tierIdx, tier := range order {
 			waterlog.Goodf("Tier %d: ", tierIdx+1)
 			for _, pkg := range tier {
@@ -182,3 +189,67 @@ func runQuery(cmd *cobra.Command, args []string) {
 		fmt.Println()
 	}
 }
+
+func printCycles(qerr st.QueryHasCyclesErr) {
+	waterlog.Errorln("Graph contains cycles:")
+	for cycleIdx, cycle := range qerr.Cycles {
+		waterlog.Errorf("Cycle %d: ", cycleIdx+1)
+		for _, pkg := range cycle.Members {
+			fmt.Printf("%s ", pkg.Show(showSub, true))
+		}
+		fmt.Println()
+
+		if len(cycle.Chain) == 0 {
+			continue
+		}
+		waterlog.Warnf("One of the dependency chains that led to this cycle: ")
+		for _, pkg := range cycle.Chain {
+			fmt.Printf("%s -> ", pkg.Show(showSub, true))
+		}
+		fmt.Println(cycle.Chain[0].Show(showSub, true))
+	}
+}
+
+func printSchedule(state st.State, qset map[int]bool) {
+	buildStats, err := stats.Load(statsPath)
+	if err != nil {
+		waterlog.Fatalf("Failed to load build stats: %s\n", err)
+	}
+
+	var unknown []string
+	sched := st.QuerySchedule(state, func(i int) bool { return qset[i] }, func(pkg common.Package) time.Duration {
+		d, ok := buildStats.Estimate(pkg.Source)
+		if !ok {
+			unknown = append(unknown, pkg.Source)
+			d = defaultDuration
+		}
+		return d
+	}, builders)
+
+	slices.Sort(unknown)
+	if unknown = utils.Uniq2(unknown); len(unknown) > 0 {
+		waterlog.Warnf("No build durations known for %d packages, assuming %s for them\n", len(unknown), defaultDuration)
+		waterlog.Debugf("Packages without build durations: %q\n", unknown)
+	}
+
+	waterlog.Goodf("Schedule for %d builders:\n", builders)
+	slots := make(map[int]utils.Slot)
+	for _, slot := range sched.Slots {
+		slots[slot.Node] = slot
+		pkg := state.Packages()[slot.Node]
+		fmt.Printf("%10s  builder %d  %s (%s)\n", slot.Start, slot.Builder+1, pkg.Show(showSub, true), slot.Finish-slot.Start)
+	}
+
+	waterlog.Goodf("Estimated makespan: %s\n", sched.Makespan)
+	waterlog.Good("Critical path: ")
+	var total time.Duration
+	for idx, node := range sched.CriticalPath {
+		if idx > 0 {
+			fmt.Print(" -> ")
+		}
+		pkg := state.Packages()[node]
+		fmt.Print(pkg.Show(showSub, true))
+		total += slots[node].Finish - slots[node].Start
+	}
+	fmt.Printf(" (%s)\n", total)
+}
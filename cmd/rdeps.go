@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/DataDrake/waterlog"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	linkOnly bool
+
+	sonameRe = regexp.MustCompile(`^lib[^/()]+\.so(\.[0-9]+)*$`)
+
+	cmdRdeps = &cobra.Command{
+		Use:   "rdeps [src|bin|dir|repo|overlay:path] [names/providers]",
+		Short: "List the packages that depend on or link against the given providers",
+		Long: `List the packages that depend on or link against the given package names or providers.
+
+For example: autobuild rdeps --link src:../packages libfoo.so.3
+
+A bare soname such as "libfoo.so.3" is short for "soname(libfoo.so.3(x86_64))".
+
+With --link, only the dependencies detected from the built artefacts are
+considered, i.e. the rundeps that ypkg generated in pspec_x86_64.xml, the
+soname dependencies in stone manifests, or the rundeps in a binary index.
+This is what you want to know during a library ABI bump.
+
+Binary indexes (bin: and repo:) don't list the files of packages, so sonames
+can't be found in them, nor in the packages that only a --fallback index has.`,
+		Run: runRdeps,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("expects a tpath and at least one name or provider")
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	cmdRdeps.Flags().BoolVarP(&linkOnly, "link", "l", false, "only list packages whose built artefacts depend on the providers")
+	cmdRdeps.Flags().BoolVar(&showSub, "show-sub", false, "show the subpackages that a node represents instead of just the recipe name")
+}
+
+func runRdeps(cmd *cobra.Command, args []string) {
+	tpath := args[0]
+
+	state, err := st.LoadState(tpath, fallbackState)
+	if err != nil {
+		waterlog.Fatalf("Failed to parse state: %s\n", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	for _, query := range args[1:] {
+		if sonameRe.MatchString(query) {
+			query = fmt.Sprintf("soname(%s(x86_64))", query)
+		}
+
+		sub, rdeps, err := st.ReverseDeps(state, query, linkOnly)
+		if err != nil {
+			waterlog.Fatalf("Failed to find reverse dependencies of %s: %s\n", query, err)
+		}
+
+		waterlog.Goodf("%s (provided by %s): ", query, sub)
+		for _, pkg := range rdeps {
+			fmt.Printf("%s ", pkg.Show(showSub, true))
+		}
+		fmt.Println()
+	}
+}
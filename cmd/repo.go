@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdRepo = &cobra.Command{
+		Use:   "repo",
+		Short: "Manage the cached indexes of remote repositories",
+		Long: `Manage the cached indexes of remote repositories used by repo: tpaths.
+
+Fetched indexes are cached under $XDG_CACHE_HOME/autobuild/repos and
+revalidated on every use. Pass --offline to any command to use the cached
+copies without contacting the remotes.`,
+	}
+
+	cmdRepoRefresh = &cobra.Command{
+		Use:   "refresh <names>",
+		Short: "Fetch the indexes of the given remotes if they have changed",
+		Run:   runRepoRefresh,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("expects at least one remote name")
+			}
+			return nil
+		},
+	}
+
+	cmdRepoList = &cobra.Command{
+		Use:   "list",
+		Short: "List the cached remote indexes",
+		Run:   runRepoList,
+		Args:  cobra.NoArgs,
+	}
+
+	cmdRepoClean = &cobra.Command{
+		Use:   "clean [names]",
+		Short: "Remove the cached indexes of the given remotes, or all of them",
+		Run:   runRepoClean,
+	}
+)
+
+func init() {
+	cmdRepo.AddCommand(cmdRepoRefresh)
+	cmdRepo.AddCommand(cmdRepoList)
+	cmdRepo.AddCommand(cmdRepoClean)
+}
+
+func runRepoRefresh(cmd *cobra.Command, args []string) {
+	if state.Offline {
+		waterlog.Fatalln("Cannot refresh remote indexes in offline mode!")
+	}
+
+	for _, name := range args {
+		path, err := state.FetchRemote(name)
+		if err != nil {
+			waterlog.Fatalf("Failed to refresh %s: %s\n", name, err)
+		}
+		waterlog.Goodf("Refreshed %s: %s\n", name, path)
+	}
+}
+
+func runRepoList(cmd *cobra.Command, args []string) {
+	cached, err := state.ListCached()
+	if err != nil {
+		waterlog.Fatalf("Failed to list cached indexes: %s\n", err)
+	}
+
+	if len(cached) == 0 {
+		waterlog.Infoln("No cached indexes")
+		return
+	}
+
+	for _, c := range cached {
+		fmt.Printf("%s\t%s\t%d bytes\tfetched %s\n", c.Name, c.URL, c.Size, c.Fetched.Format(time.DateTime))
+	}
+}
+
+func runRepoClean(cmd *cobra.Command, args []string) {
+	if err := state.CleanCache(args...); err != nil {
+		waterlog.Fatalf("Failed to clean cached indexes: %s\n", err)
+	}
+	waterlog.Goodln("Successfully cleaned cached indexes!")
+}
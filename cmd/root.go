@@ -9,6 +9,9 @@ import (
 
 	"github.com/DataDrake/waterlog"
 	"github.com/DataDrake/waterlog/format"
+	"github.com/GZGavinZhao/autobuild/config"
+	"github.com/GZGavinZhao/autobuild/progress"
+	"github.com/GZGavinZhao/autobuild/state"
 	"github.com/spf13/cobra"
 )
 
@@ -31,11 +34,28 @@ var (
 			waterlog.SetFormat(format.Min)
 			if quiet {
 				waterlog.SetLevel(0)
+				progress.Enabled = false
 			} else if verbose {
 				waterlog.SetLevel(7)
 			} else {
 				waterlog.SetLevel(6)
 			}
+
+			var err error
+			globalCfg, err = config.LoadGlobal(configPath)
+			if err != nil {
+				waterlog.Fatalf("Failed to load config file %s: %s\n", configPath, err)
+			}
+			for name, remote := range globalCfg.Remotes {
+				state.Remotes[name] = remote
+			}
+
+			if len(fallback) > 0 {
+				if fallbackState, err = state.LoadState(fallback, nil); err != nil {
+					waterlog.Fatalf("Failed to parse fallback state %s: %s\n", fallback, err)
+				}
+				waterlog.Goodf("Successfully parsed fallback state %s!\n", fallback)
+			}
 		},
 		Version: "0.0.0+" + GitCommit,
 	}
@@ -45,9 +65,16 @@ func init() {
 	rootCmd.AddCommand(cmdQuery)
 	rootCmd.AddCommand(cmdDiff)
 	rootCmd.AddCommand(cmdPush)
+	rootCmd.AddCommand(cmdRdeps)
+	rootCmd.AddCommand(cmdRepo)
+	rootCmd.AddCommand(cmdBootstrap)
+	rootCmd.AddCommand(cmdJob)
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "quiet output")
+	rootCmd.PersistentFlags().BoolVar(&state.Offline, "offline", false, "use cached remote indexes without fetching them")
+	rootCmd.PersistentFlags().StringVar(&fallback, "fallback", "", "tpath (e.g. repo:unstable) that satisfies build dependencies not provided by any source recipe")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", config.GlobalConfigPath(), "path to the global config file")
 	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
 }
 
@@ -5,10 +5,10 @@
 package common
 
 import (
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"path/filepath"
-	"regexp"
 	"slices"
 	"strings"
 
@@ -16,18 +16,14 @@ import (
 	"github.com/GZGavinZhao/autobuild/config"
 	"github.com/GZGavinZhao/autobuild/utils"
 	"github.com/GZGavinZhao/autobuild/ypkg"
+	"github.com/getsolus/libeopkg/archive"
 	"github.com/getsolus/libeopkg/index"
 	"github.com/getsolus/libeopkg/pspec"
+	"github.com/getsolus/libeopkg/shared"
 	"github.com/jwalton/gchalk"
 	"gopkg.in/yaml.v3"
 )
 
-var (
-	// pcre = regexp.MustCompile(`/usr/(lib|lib64|lib32|share)/[^/]+\.pc`)
-	pcre    = regexp.MustCompile(`/usr/(lib|lib64|lib32|share)/.+\.pc$`)
-	oldpcre = regexp.MustCompile(`/usr/(lib|lib64|lib32|share)/.+\.pc`)
-)
-
 type Package struct {
 	Path      string
 	Names     []string
@@ -37,10 +33,19 @@ type Package struct {
 	Release   int
 	Provides  []string
 	BuildDeps []string
-	Ignores   []string
-	Resolved  bool
-	Built     bool
-	Synced    bool
+	// SubProvides maps the name of each subpackage to what it provides.
+	SubProvides map[string][]string
+	// LinkDeps are the runtime dependencies detected from the built
+	// artefacts instead of declared in the recipe, e.g. the shared libraries
+	// that they link against.
+	LinkDeps []string
+	Ignores  []string
+	// Stage1 are the regexes of the build dependencies that can be left out
+	// of a stage1 build when bootstrapping, see config.SolverConfig.
+	Stage1   []string
+	Resolved bool
+	Built    bool
+	Synced   bool
 }
 
 // // Merge the info from `other` to itself. Prefer `other` if different.
@@ -112,8 +117,6 @@ func (p *Package) Resolve(nameToSrcIdx map[string]int, pkgs []Package) (res []st
 func ParsePackage(dir string) (pkgs []Package, err error) {
 	// Check if the given directory contains a package definition
 	pkgFile := filepath.Join(dir, "package.yml")
-	pspecFile := filepath.Join(dir, "pspec_x86_64.xml")
-	cfgFile := filepath.Join(dir, "autobuild.yml")
 
 	ypkgYml, err := ypkg.Load(pkgFile)
 	if err != nil {
@@ -131,6 +134,7 @@ func ParsePackage(dir string) (pkgs []Package, err error) {
 		Synced:    false},
 	)
 	pkg := &pkgs[0]
+	pkg.SubProvides = make(map[string][]string)
 
 	// Combine the rundeps of all subpackages into a single list
 	// Note to self: this website can inspect yaml ast nodes:
@@ -152,102 +156,176 @@ func ParsePackage(dir string) (pkgs []Package, err error) {
 				}
 			}
 		}
-	} else {
+	} else if rundeps.Kind != 0 {
 		err = errors.New(fmt.Sprintf("%s has unknown \"rundeps\" field kind: %s", dir, rundeps.Value))
+		return
 	}
 
 	if ypkgYml.Clang {
 		pkg.BuildDeps = append(pkg.BuildDeps, "llvm-clang-devel")
 	}
 
-	if !utils.PathExists(pspecFile) {
-		return
-	}
+	var abConfig config.AutobuildConfig
+	for _, cfgFile := range []string{"autobuild.yaml", "autobuild.yml"} {
+		cfgFile = filepath.Join(dir, cfgFile)
+		if !utils.PathExists(cfgFile) {
+			continue
+		}
 
-	pspecXml, err := pspec.Load(pspecFile)
-	if err != nil {
-		err = errors.New(fmt.Sprintf("Failed to load pspec_x86_64.xml for %s: %s", dir, err))
-		return
+		if abConfig, err = config.Load(cfgFile); err != nil {
+			err = fmt.Errorf("Failed to load autobuild config file for %s: %w", dir, err)
+			return
+		}
+		break
 	}
-	for _, subPkg := range pspecXml.Packages {
-		pkg.Provides = append(pkg.Provides, subPkg.Name)
 
-		for _, pcProvide := range getPcProvides(&subPkg) {
-			pkg.Provides = append(pkg.Provides, pcProvide)
+	pkg.Ignores = append(pkg.Ignores, abConfig.Solver.Ignore...)
+	pkg.Stage1 = abConfig.Solver.Stage1
+
+	analyser := defaultPspecAnalyser
+	if len(abConfig.Pspec.Rules) > 0 {
+		if analyser, err = NewPspecAnalyser(abConfig.Pspec.Rules); err != nil {
+			err = fmt.Errorf("Failed to load pspec rules for %s: %w", dir, err)
+			return
 		}
 	}
 
-	if !utils.PathExists(cfgFile) {
+	// Usually there is only `pspec_x86_64.xml`, which also lists the -32bit
+	// subpackages of emul32 builds.
+	pspecFiles, err := filepath.Glob(filepath.Join(dir, "pspec_*.xml"))
+	if err != nil {
 		return
 	}
+	slices.Sort(pspecFiles)
 
-	abConfig, err := config.Load(cfgFile)
-	if err != nil {
-		err = errors.New(fmt.Sprintf("Failed to load autobuild config file for %s: %s", dir, err))
-	}
+	for _, pspecFile := range pspecFiles {
+		var pspecXml *pspec.PSpec
+		if pspecXml, err = pspec.Load(pspecFile); err != nil {
+			err = fmt.Errorf("Failed to load %s for %s: %w", filepath.Base(pspecFile), dir, err)
+			return
+		}
+
+		for _, subPkg := range pspecXml.Packages {
+			provides := analyser.Provides(&subPkg)
+			pkg.Provides = append(pkg.Provides, provides...)
+			pkg.SubProvides[subPkg.Name] = append(pkg.SubProvides[subPkg.Name], provides...)
+		}
 
-	// ignoreRegexes := []regexp.Regexp{}
-	for _, ignore := range abConfig.Solver.Ignore {
-		// ignoreRegexes = append(ignoreRegexes, *regexp.MustCompile(ignore))
-		pkg.Ignores = append(pkg.Ignores, ignore)
+		// ypkg adds the packages providing the shared libraries (and
+		// pkgconfig files for -devel) that a subpackage uses to its rundeps.
+		// They are kept even if `package.yml` declares them too, since
+		// those are exactly the packages that link against them.
+		for _, subPkg := range pspecXml.Packages {
+			for _, dep := range runtimeDeps(subPkg.RuntimeDependencies) {
+				if _, internal := pkg.SubProvides[dep]; internal {
+					continue
+				}
+				pkg.LinkDeps = append(pkg.LinkDeps, dep)
+			}
+		}
 	}
-	// pkg.BuildDeps = utils.Filter(pkg.BuildDeps, func(dep string) bool {
-	// 	for _, regex := range ignoreRegexes {
-	// 		if regex.FindString(dep) == dep {
-	// 			waterlog.Debugf("Dropping builddep %s from %s due to ignore regex %s\n", dep, pkg.Name, regex.String())
-	// 			return false
-	// 		}
-	// 	}
-	// 	return true
-	// })
 
 	slices.Sort(pkg.BuildDeps)
 	slices.Sort(pkg.Provides)
+	pkg.Provides = utils.Uniq2(pkg.Provides)
+	slices.Sort(pkg.LinkDeps)
+	pkg.LinkDeps = utils.Uniq2(pkg.LinkDeps)
 	slices.Sort(pkg.Ignores)
 
 	return
 }
 
-func getPcProvides(pkg *pspec.Package) []string {
-	var provides []string
+// ParseArchivePackage parses a built `.eopkg` package whose metadata and
+// files have been read, e.g. with archive.OpenAll.
+//
+// Unlike ParseIndexPackage, the file list is available, so the providers are
+// derived from it in the same way as for `pspec_*.xml`.
+func ParseArchivePackage(a *archive.Archive) (pkg Package, err error) {
+	if a.Meta == nil || a.Meta.Package == nil || a.Files == nil {
+		err = fmt.Errorf("Metadata or files of %s have not been read", a.Path)
+		return
+	}
 
-	for _, file := range pkg.Files {
-		match := pcre.FindString(file.Value)
-		pcFile := filepath.Base(match)
-		if pcFile == "." || pcFile == "*.pc" {
-			continue
-		}
+	meta := a.Meta.Package
+	if len(meta.History) == 0 {
+		err = fmt.Errorf("%s has no history", a.Path)
+		return
+	}
 
-		splitted := strings.Split(match, "/")
-		if len(splitted) > 5 {
-			continue
-		}
+	pkg.Path = a.Path
+	pkg.Source = meta.Source.Name
+	pkg.Names = append(pkg.Names, meta.Name)
+	pkg.Release = meta.History[0].Release
+	pkg.Version = meta.History[0].Version
 
-		if slices.Contains(splitted, "lib32") {
-			provides = append(provides, fmt.Sprintf("pkgconfig32(%s)", pcFile[:len(pcFile)-3]))
-		} else if slices.Contains(splitted, "share") {
-			provides = append(provides, fmt.Sprintf("pkgconfig(%s)", pcFile[:len(pcFile)-3]))
-			provides = append(provides, fmt.Sprintf("pkgconfig32(%s)", pcFile[:len(pcFile)-3]))
-		} else {
-			provides = append(provides, fmt.Sprintf("pkgconfig(%s)", pcFile[:len(pcFile)-3]))
-		}
+	paths := make([]string, len(a.Files.File))
+	for i, file := range a.Files.File {
+		paths[i] = "/" + strings.TrimPrefix(file.Path, "/")
+	}
+
+	pkg.Provides = append([]string{fmt.Sprintf("name(%s)", meta.Name)}, defaultPspecAnalyser.PathsProvides(paths)...)
+	pkg.SubProvides = map[string][]string{meta.Name: pkg.Provides}
+	if meta.RuntimeDependencies != nil {
+		pkg.LinkDeps = runtimeDeps(*meta.RuntimeDependencies)
 	}
 
-	return provides
+	return
 }
 
 func ParseIndexPackage(ipkg index.Package) (pkg Package, err error) {
 	pkg.Source = ipkg.Source.Name
 	pkg.Names = append(pkg.Names, ipkg.Name)
 	pkg.Provides = append(pkg.Provides, fmt.Sprintf("name(%s)", ipkg.Name))
+	if ipkg.Provides != nil {
+		for _, pc := range ipkg.Provides.PkgConfig {
+			pkg.Provides = append(pkg.Provides, fmt.Sprintf("pkgconfig(%s)", pc))
+		}
+		for _, pc := range ipkg.Provides.PkgConfig32 {
+			pkg.Provides = append(pkg.Provides, fmt.Sprintf("pkgconfig32(%s)", pc))
+		}
+	}
+	pkg.SubProvides = map[string][]string{ipkg.Name: pkg.Provides}
+	pkg.LinkDeps = runtimeDeps(ipkg.RuntimeDependencies)
 
+	if len(ipkg.History) == 0 {
+		err = fmt.Errorf("Package %s in index has no history", ipkg.Name)
+		return
+	}
 	latest := ipkg.History[0]
 	pkg.Release = latest.Release
 	pkg.Version = latest.Version
 
-	// TODO: we intentionally don't add anything besides version information,
-	// because we don't need to. Right now, we only use binary index for diffing
-	// against another source/binary index to see what packages have changed.
+	// TODO: the index doesn't list the files of a package, so unlike
+	// ParseArchivePackage, only its name and pkgconfig providers are known.
+	// That's enough to diff against another index, list reverse
+	// dependencies and satisfy the build dependencies of a source state.
+
+	return
+}
+
+// runtimeDeps returns the names of the packages in a `<RuntimeDependencies>`
+// list.
+//
+// libeopkg maps each `<RuntimeDependencies>` element, instead of each
+// `<Dependency>` in it, to a shared.Dependency, so the names we want are
+// still in the inner XML.
+func runtimeDeps(deps []shared.Dependency) (names []string) {
+	for _, dep := range deps {
+		if !strings.Contains(dep.Name, "<") {
+			names = append(names, strings.TrimSpace(dep.Name))
+			continue
+		}
+
+		var list struct {
+			Deps []string `xml:"Dependency"`
+		}
+		if err := xml.Unmarshal([]byte("<list>"+dep.Name+"</list>"), &list); err != nil {
+			continue
+		}
+		for _, name := range list.Deps {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
 
 	return
 }
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// archAliases maps the different spellings of an architecture found in
+	// manifests and file names to the one we use internally.
+	archAliases = map[string]string{
+		"x86_64": "x86_64",
+		"amd64":  "x86_64",
+		"x86":    "x86",
+		"386":    "x86",
+		"i386":   "x86",
+		"i686":   "x86",
+		"emul32": "x86",
+	}
+)
+
+// PrimaryArch is the architecture that providers and dependencies without an
+// explicit one are for.
+const PrimaryArch = "x86_64"
+
+// Provider is a parsed provider or dependency string, such as `name(foo)`,
+// `pkgconfig32(bar)` or `soname(libc.so.6(x86_64))`.
+//
+// Arch is set when the provider carries an explicit architecture, e.g. every
+// provider and dependency read from a stone manifest, which is per
+// architecture, such as `name(foo(x86))` from `manifest.x86.bin`.
+type Provider struct {
+	Kind string
+	Name string
+	Arch string
+}
+
+// NormalizeArch returns the canonical spelling of `arch`, or `arch` itself if
+// it's unknown.
+func NormalizeArch(arch string) string {
+	if canon, ok := archAliases[arch]; ok {
+		return canon
+	}
+	return arch
+}
+
+// ParseProvider parses `s` into a Provider. Strings that are not in the
+// `kind(name)` form, such as the plain package names used by ypkg, are
+// returned with an empty Kind.
+func ParseProvider(s string) (p Provider) {
+	open := strings.Index(s, "(")
+	if open <= 0 || !strings.HasSuffix(s, ")") {
+		p.Name = s
+		return
+	}
+
+	p.Kind = s[:open]
+	p.Name = s[open+1 : len(s)-1]
+
+	if archOpen := strings.LastIndex(p.Name, "("); archOpen > 0 && strings.HasSuffix(p.Name, ")") {
+		p.Arch = NormalizeArch(p.Name[archOpen+1 : len(p.Name)-1])
+		p.Name = p.Name[:archOpen]
+	}
+
+	return
+}
+
+func (p Provider) String() string {
+	if len(p.Kind) == 0 {
+		return p.Name
+	} else if len(p.Arch) == 0 {
+		return fmt.Sprintf("%s(%s)", p.Kind, p.Name)
+	} else {
+		return fmt.Sprintf("%s(%s(%s))", p.Kind, p.Name, p.Arch)
+	}
+}
+
+// NormalizeProvider rewrites `s` so that equivalent providers compare equal,
+// e.g. `soname(libc.so.6(386))` and `soname(libc.so.6(x86))`.
+func NormalizeProvider(s string) string {
+	return ParseProvider(s).String()
+}
+
+// ProviderCandidates returns the providers that satisfy the dependency `s`,
+// the best first: `s` itself, then the same provider for the primary
+// architecture if `s` has no architecture, or the same provider without an
+// architecture if it has one, such as the providers guessed from recipes that
+// haven't been built yet. A dependency for one architecture is never
+// satisfied by a provider for another.
+func ProviderCandidates(s string) []string {
+	pvd := ParseProvider(s)
+	if len(pvd.Kind) == 0 {
+		return []string{s}
+	}
+
+	other := pvd
+	if len(pvd.Arch) == 0 {
+		other.Arch = PrimaryArch
+	} else {
+		other.Arch = ""
+	}
+	return []string{s, other.String()}
+}
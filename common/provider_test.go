@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseProvider(t *testing.T) {
+	tests := []struct {
+		str  string
+		want Provider
+		norm string
+	}{
+		{"zlib", Provider{Name: "zlib"}, "zlib"},
+		{"name(zlib)", Provider{Kind: "name", Name: "zlib"}, "name(zlib)"},
+		{"name(zlib(x86))", Provider{Kind: "name", Name: "zlib", Arch: "x86"}, "name(zlib(x86))"},
+		{"binary(gzip(emul32))", Provider{Kind: "binary", Name: "gzip", Arch: "x86"}, "binary(gzip(x86))"},
+		{"soname(libc.so.6(386))", Provider{Kind: "soname", Name: "libc.so.6", Arch: "x86"}, "soname(libc.so.6(x86))"},
+		{"soname(libc.so.6(amd64))", Provider{Kind: "soname", Name: "libc.so.6", Arch: "x86_64"}, "soname(libc.so.6(x86_64))"},
+		{"pkgconfig32(zlib)", Provider{Kind: "pkgconfig32", Name: "zlib"}, "pkgconfig32(zlib)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.str, func(t *testing.T) {
+			if got := ParseProvider(tt.str); got != tt.want {
+				t.Errorf("ParseProvider(%q) = %+v, want %+v", tt.str, got, tt.want)
+			}
+			if got := NormalizeProvider(tt.str); got != tt.norm {
+				t.Errorf("NormalizeProvider(%q) = %q, want %q", tt.str, got, tt.norm)
+			}
+		})
+	}
+}
+
+func TestProviderCandidates(t *testing.T) {
+	tests := []struct {
+		dep  string
+		want []string
+	}{
+		{"zlib", []string{"zlib"}},
+		{"name(zlib)", []string{"name(zlib)", "name(zlib(x86_64))"}},
+		{"name(zlib(x86_64))", []string{"name(zlib(x86_64))", "name(zlib)"}},
+		// Never the provider of the primary architecture
+		{"name(zlib(x86))", []string{"name(zlib(x86))", "name(zlib)"}},
+		{"soname(libc.so.6(x86))", []string{"soname(libc.so.6(x86))", "soname(libc.so.6)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dep, func(t *testing.T) {
+			if got := ProviderCandidates(tt.dep); !slices.Equal(got, tt.want) {
+				t.Errorf("ProviderCandidates(%q) = %q, want %q", tt.dep, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/GZGavinZhao/autobuild/config"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/getsolus/libeopkg/pspec"
+)
+
+var (
+	// DefaultPspecRules are the rules used to derive providers from the file
+	// lists in `pspec_*.xml`. They mirror what ypkg and eopkg consider to be
+	// provided by a package, including the `/usr/lib32` files of emul32
+	// builds.
+	//
+	// Recipes can add more rules in the `pspec` section of `autobuild.yml`.
+	DefaultPspecRules = []config.PspecRule{
+		{Pattern: `^/usr/(?:lib|lib64)/pkgconfig/([^/]+)\.pc$`, Provides: []string{"pkgconfig($1)"}},
+		{Pattern: `^/usr/lib32/pkgconfig/([^/]+)\.pc$`, Provides: []string{"pkgconfig32($1)"}},
+		{Pattern: `^/usr/share/pkgconfig/([^/]+)\.pc$`, Provides: []string{"pkgconfig($1)", "pkgconfig32($1)"}},
+		{Pattern: `^/usr/(?:lib|lib64)/(lib[^/]+\.so\.[0-9]+)$`, Provides: []string{"soname($1(x86_64))"}},
+		{Pattern: `^/usr/lib32/(lib[^/]+\.so\.[0-9]+)$`, Provides: []string{"soname($1(x86))"}},
+		{Pattern: `^/usr/bin/([^/]+)$`, Provides: []string{"binary($1)"}},
+		{Pattern: `^/usr/lib/python3\.[0-9]+/site-packages/([A-Za-z0-9_]+)/__init__\.py$`, Provides: []string{"python($1)"}},
+		{Pattern: `^/usr/lib/python3\.[0-9]+/site-packages/([A-Za-z0-9_]+)\.py$`, Provides: []string{"python($1)"}},
+		{Pattern: `^/usr/lib/perl5/vendor_perl/[^/]+/(?:x86_64-linux-thread-multi/)?(.+)\.pm$`, Provides: []string{"perl($1)"}, PathSep: "::"},
+	}
+)
+
+type pspecRule struct {
+	re       *regexp.Regexp
+	provides []string
+	pathSep  string
+}
+
+// PspecAnalyser derives the providers of ypkg packages from the file lists in
+// their `pspec_*.xml`.
+type PspecAnalyser struct {
+	rules []pspecRule
+}
+
+// defaultPspecAnalyser only has DefaultPspecRules, which are compiled when the
+// package is initialized.
+var defaultPspecAnalyser = func() *PspecAnalyser {
+	a := &PspecAnalyser{}
+	for _, rule := range DefaultPspecRules {
+		a.rules = append(a.rules, pspecRule{
+			re:       regexp.MustCompile(rule.Pattern),
+			provides: rule.Provides,
+			pathSep:  rule.PathSep,
+		})
+	}
+	return a
+}()
+
+// NewPspecAnalyser returns an analyser with DefaultPspecRules followed by
+// `extra`.
+func NewPspecAnalyser(extra []config.PspecRule) (a *PspecAnalyser, err error) {
+	a = &PspecAnalyser{rules: slices.Clone(defaultPspecAnalyser.rules)}
+
+	for _, rule := range extra {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(rule.Pattern); err != nil {
+			err = fmt.Errorf("Invalid pspec rule pattern %s: %w", rule.Pattern, err)
+			return
+		}
+
+		a.rules = append(a.rules, pspecRule{
+			re:       re,
+			provides: rule.Provides,
+			pathSep:  rule.PathSep,
+		})
+	}
+
+	return
+}
+
+// FileProvides returns the providers generated by a single file path.
+func (a *PspecAnalyser) FileProvides(path string) (provides []string) {
+	for _, rule := range a.rules {
+		submatches := rule.re.FindStringSubmatch(path)
+		if submatches == nil {
+			continue
+		}
+
+		if len(rule.pathSep) > 0 {
+			for i := range submatches[1:] {
+				submatches[i+1] = strings.ReplaceAll(submatches[i+1], "/", rule.pathSep)
+			}
+		}
+
+		for _, tmpl := range rule.provides {
+			provides = append(provides, os.Expand(tmpl, func(key string) string {
+				i, err := strconv.Atoi(key)
+				if err != nil || i >= len(submatches) {
+					return ""
+				}
+				return submatches[i]
+			}))
+		}
+	}
+
+	return
+}
+
+// PathsProvides returns the providers generated by a list of file paths,
+// sorted and deduplicated.
+func (a *PspecAnalyser) PathsProvides(paths []string) (provides []string) {
+	for _, path := range paths {
+		provides = append(provides, a.FileProvides(path)...)
+	}
+
+	slices.Sort(provides)
+	provides = utils.Uniq2(provides)
+	return
+}
+
+// Provides returns the providers of a pspec package: its name followed by the
+// providers generated by its files, sorted and deduplicated.
+func (a *PspecAnalyser) Provides(pkg *pspec.Package) (provides []string) {
+	paths := make([]string, len(pkg.Files))
+	for i, file := range pkg.Files {
+		paths[i] = file.Value
+	}
+
+	return append([]string{pkg.Name}, a.PathsProvides(paths)...)
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/config"
+	"github.com/getsolus/libeopkg/pspec"
+)
+
+func TestDefaultPspecRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		provides []string
+	}{
+		// Files of -devel subpackages
+		{"devel pkgconfig", "/usr/lib64/pkgconfig/zlib.pc", []string{"pkgconfig(zlib)"}},
+		{"devel pkgconfig in lib", "/usr/lib/pkgconfig/libffi.pc", []string{"pkgconfig(libffi)"}},
+		{"devel arch-independent pkgconfig", "/usr/share/pkgconfig/xproto.pc", []string{"pkgconfig(xproto)", "pkgconfig32(xproto)"}},
+		{"devel unversioned library symlink", "/usr/lib64/libz.so", nil},
+		{"devel header", "/usr/include/zlib.h", nil},
+		{"devel nested pkgconfig", "/usr/lib64/pkgconfig/sub/zlib.pc", nil},
+
+		// Files of the main package
+		{"soname", "/usr/lib64/libz.so.1", []string{"soname(libz.so.1(x86_64))"}},
+		{"fully versioned library", "/usr/lib64/libz.so.1.3", nil},
+		{"binary", "/usr/bin/gzip", []string{"binary(gzip)"}},
+		{"nested binary", "/usr/bin/subdir/tool", nil},
+		{"python package", "/usr/lib/python3.11/site-packages/yaml/__init__.py", []string{"python(yaml)"}},
+		{"python module", "/usr/lib/python3.12/site-packages/six.py", []string{"python(six)"}},
+		{"perl module", "/usr/lib/perl5/vendor_perl/5.38.0/x86_64-linux-thread-multi/XML/Parser.pm", []string{"perl(XML::Parser)"}},
+		{"arch-independent perl module", "/usr/lib/perl5/vendor_perl/5.38.0/Text/CSV.pm", []string{"perl(Text::CSV)"}},
+
+		// Files of -32bit subpackages of emul32 builds
+		{"32bit pkgconfig", "/usr/lib32/pkgconfig/zlib.pc", []string{"pkgconfig32(zlib)"}},
+		{"32bit soname", "/usr/lib32/libz.so.1", []string{"soname(libz.so.1(x86))"}},
+		{"32bit unversioned library symlink", "/usr/lib32/libz.so", nil},
+
+		// Files of -dbginfo subpackages
+		{"dbginfo of library", "/usr/lib/debug/usr/lib64/libz.so.1.debug", nil},
+		{"dbginfo of 32bit library", "/usr/lib/debug/usr/lib32/libz.so.1.debug", nil},
+		{"dbginfo of binary", "/usr/lib/debug/usr/bin/gzip.debug", nil},
+		{"dbginfo build-id", "/usr/lib/debug/.build-id/ab/cdef.debug", nil},
+
+		// Files of -docs subpackages
+		{"docs", "/usr/share/doc/zlib/README", nil},
+		{"man page", "/usr/share/man/man3/zlib.3", nil},
+		{"info page", "/usr/share/info/gzip.info", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provides := defaultPspecAnalyser.FileProvides(tt.path)
+			if !slices.Equal(provides, tt.provides) {
+				t.Errorf("FileProvides(%q) = %q, want %q", tt.path, provides, tt.provides)
+			}
+		})
+	}
+}
+
+func TestPspecAnalyserProvides(t *testing.T) {
+	pkg := pspec.Package{
+		Name: "zlib-32bit-devel",
+		Files: []pspec.Path{
+			{Value: "/usr/lib32/pkgconfig/zlib.pc"},
+			{Value: "/usr/lib32/libz.so"},
+			{Value: "/usr/share/pkgconfig/zlib.pc"},
+		},
+	}
+	want := []string{"zlib-32bit-devel", "pkgconfig(zlib)", "pkgconfig32(zlib)"}
+
+	if provides := defaultPspecAnalyser.Provides(&pkg); !slices.Equal(provides, want) {
+		t.Errorf("Provides() = %q, want %q", provides, want)
+	}
+}
+
+func TestNewPspecAnalyser(t *testing.T) {
+	a, err := NewPspecAnalyser([]config.PspecRule{
+		{Pattern: `^/usr/share/vala/vapi/([^/]+)\.vapi$`, Provides: []string{"vapi($1)"}},
+	})
+	if err != nil {
+		t.Fatalf("NewPspecAnalyser() failed: %s", err)
+	}
+
+	paths := []string{"/usr/share/vala/vapi/gio-2.0.vapi", "/usr/lib64/pkgconfig/gio-2.0.pc"}
+	want := []string{"pkgconfig(gio-2.0)", "vapi(gio-2.0)"}
+	if provides := a.PathsProvides(paths); !slices.Equal(provides, want) {
+		t.Errorf("PathsProvides(%q) = %q, want %q", paths, provides, want)
+	}
+
+	if _, err := NewPspecAnalyser([]config.PspecRule{{Pattern: `^/usr/(lib`}}); err == nil {
+		t.Error("NewPspecAnalyser() with an invalid pattern succeeded")
+	}
+}
@@ -13,6 +13,7 @@ import (
 type AutobuildConfig struct {
 	Ignore bool         `yaml:"ignore"`
 	Solver SolverConfig `yaml:"solver"`
+	Pspec  PspecConfig  `yaml:"pspec"`
 }
 
 func Load(path string) (cfg AutobuildConfig, err error) {
@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GlobalConfig is the per-user configuration of autobuild, as opposed to
+// AutobuildConfig which lives next to a recipe.
+type GlobalConfig struct {
+	Remotes map[string]RemoteConfig `yaml:"remotes"`
+	Backend BackendConfig           `yaml:"backend"`
+}
+
+// BackendConfig selects and configures the build backend that `autobuild
+// push` publishes packages to.
+type BackendConfig struct {
+	// Kind is one of `ssh` (the Solus build server, the default), `local`
+	// (build on this machine) and `fake` (pretend to build, for testing).
+	Kind string `yaml:"kind"`
+	// User and Host are the login of the build controller for `ssh`.
+	User string `yaml:"user"`
+	Host string `yaml:"host"`
+	// Command and StoneCommand are the build commands that `local` runs in
+	// the directory of each ypkg and stone recipe respectively. The default
+	// Command runs solbuild with `sudo -n`, so it needs passwordless sudo and
+	// fails instead of waiting for a password that nobody types.
+	Command      []string `yaml:"command"`
+	StoneCommand []string `yaml:"stone_command"`
+	// Repo is the local repository that `local` adds the artefacts matching
+	// the Artefacts globs to after each tier, so that the next tier can be
+	// built against them. IndexCommand is run in Repo afterwards.
+	Repo         string   `yaml:"repo"`
+	Artefacts    []string `yaml:"artefacts"`
+	IndexCommand []string `yaml:"index_command"`
+	// Fail are the sources that `fake` fails to build. Script maps a source
+	// to the statuses that the queries of its `fake` jobs return instead.
+	Fail   []string            `yaml:"fail"`
+	Script map[string][]string `yaml:"script"`
+	// Interval is how often the status of a job is queried at first. It
+	// doubles while the status stays the same, up to MaxInterval.
+	Interval    time.Duration `yaml:"interval"`
+	MaxInterval time.Duration `yaml:"max_interval"`
+	// Timeouts is how long a job may stay in each status, e.g. `BUILDING:
+	// 12h`. `unknown` applies to the statuses that autobuild doesn't know.
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+	// Retries is how many status queries in a row may fail before giving up
+	// on a job.
+	Retries int `yaml:"retries"`
+}
+
+// WithDefaults fills the unset fields of `b` with their default values.
+func (b BackendConfig) WithDefaults() BackendConfig {
+	if len(b.Kind) == 0 {
+		b.Kind = "ssh"
+	}
+	if len(b.User) == 0 {
+		b.User = "build-controller"
+	}
+	if len(b.Host) == 0 {
+		b.Host = "build.getsol.us"
+	}
+	if len(b.Command) == 0 {
+		b.Command = []string{"sudo", "-n", "solbuild", "build", "package.yml"}
+	}
+	if len(b.StoneCommand) == 0 {
+		b.StoneCommand = []string{"boulder", "build", "stone.yaml"}
+	}
+	if len(b.Artefacts) == 0 {
+		b.Artefacts = []string{"*.eopkg", "*.stone"}
+	}
+	if len(b.IndexCommand) == 0 {
+		b.IndexCommand = []string{"eopkg", "index", "--skip-signing", "."}
+	}
+	if b.Interval == 0 && b.Kind == "ssh" {
+		b.Interval = 15 * time.Second
+	} else if b.Interval == 0 {
+		b.Interval = time.Second
+	}
+	if b.MaxInterval == 0 {
+		b.MaxInterval = 20 * b.Interval
+	}
+	if b.Timeouts == nil {
+		b.Timeouts = map[string]time.Duration{
+			"UNCLAIMED": 24 * time.Hour,
+			"CLAIMED":   time.Hour,
+			"BUILDING":  12 * time.Hour,
+			"unknown":   time.Hour,
+		}
+	}
+	if b.Retries == 0 {
+		b.Retries = 5
+	}
+	return b
+}
+
+// RemoteConfig describes a remote binary repository for the `repo:` tpath.
+type RemoteConfig struct {
+	// URL is the base URL of the repository, e.g.
+	// `https://packages.getsol.us/unstable`. `file://` URLs are supported.
+	URL string `yaml:"url"`
+	// Index is the name of the index file under URL.
+	Index string `yaml:"index"`
+	// Compression is one of `auto`, `xz`, `zstd`, `gzip` and `none`.
+	Compression string `yaml:"compression"`
+	// Checksum is one of `sha1` (default), `sha256` and `none`. The checksum
+	// is read from `<index>.sha1sum` or `<index>.sha256sum` next to the index.
+	Checksum string        `yaml:"checksum"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// DefaultRemote returns the definition used for a `repo:` name that is not
+// configured, which points to the official Solus repository of that name.
+func DefaultRemote(name string) RemoteConfig {
+	return RemoteConfig{URL: "https://packages.getsol.us/" + name}.WithDefaults()
+}
+
+// WithDefaults fills the unset fields of `r` with their default values.
+func (r RemoteConfig) WithDefaults() RemoteConfig {
+	if len(r.Index) == 0 {
+		r.Index = "eopkg-index.xml.xz"
+	}
+	if len(r.Compression) == 0 {
+		r.Compression = "auto"
+	}
+	if len(r.Checksum) == 0 {
+		r.Checksum = "sha1"
+	}
+	if r.Timeout == 0 {
+		r.Timeout = 5 * time.Minute
+	}
+	return r
+}
+
+// GlobalConfigPath returns where the global config file is looked up,
+// i.e. `$XDG_CONFIG_HOME/autobuild/config.yaml`.
+func GlobalConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "autobuild", "config.yaml")
+}
+
+// LoadGlobal loads the global config file at `path`. A missing file is not an
+// error and results in an empty config.
+func LoadGlobal(path string) (cfg GlobalConfig, err error) {
+	raw, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+	defer raw.Close()
+
+	dec := yaml.NewDecoder(raw)
+	if err = dec.Decode(&cfg); errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return
+}
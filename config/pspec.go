@@ -0,0 +1,21 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+// PspecRule derives providers from the file lists in `pspec_*.xml`.
+//
+// Every file path matching Pattern generates the providers in Provides, where
+// `$1`, `${2}`, etc. are replaced by the corresponding submatch of Pattern.
+// When PathSep is set, `/` in the submatches is replaced by it first, which is
+// how perl module paths turn into `Foo::Bar`.
+type PspecRule struct {
+	Pattern  string   `yaml:"pattern"`
+	Provides []string `yaml:"provides"`
+	PathSep  string   `yaml:"pathsep"`
+}
+
+type PspecConfig struct {
+	Rules []PspecRule `yaml:"rules"`
+}
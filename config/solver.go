@@ -8,4 +8,7 @@ type SolverConfig struct {
 	Ignore []string            `yaml:"ignore"`
 	Split  []string            `yaml:"split"`
 	Move   map[string][]string `yaml:"move"`
+	// Stage1 are the regexes of the build dependencies that can be left out
+	// of a stage1 build of the package when bootstrapping a repository.
+	Stage1 []string `yaml:"stage1"`
 }
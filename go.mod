@@ -12,22 +12,22 @@ require (
 	github.com/dominikbraun/graph v0.23.0
 	github.com/fatih/color v1.16.0
 	github.com/getsolus/libeopkg v0.1.1-0.20230924201845-7f2598d34467
+	github.com/jwalton/gchalk v1.3.0
+	github.com/klauspost/compress v1.17.6
 	github.com/serpent-os/libstone-go v0.0.0-20240610023118-0ce587b36585
 	github.com/spf13/cobra v1.8.0
 	github.com/yourbasic/graph v0.0.0-20210606180040-8ecfec1c2869
 	github.com/zeebo/blake3 v0.2.3
+	golang.org/x/term v0.15.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/jwalton/gchalk v1.3.0 // indirect
 	github.com/jwalton/go-supportscolor v1.1.0 // indirect
-	github.com/klauspost/compress v1.17.6 // indirect
 	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/zeebo/xxh3 v1.0.2 // indirect
-	golang.org/x/term v0.15.0 // indirect
 )
 
 require (
@@ -41,10 +41,10 @@ require (
 	github.com/go-git/gcfg v1.5.1-0.20230307220236-3a3c6141e376 // indirect
 	github.com/go-git/go-billy/v5 v5.5.0 // indirect
 	github.com/go-git/go-git/v5 v5.10.1
+	github.com/kevinburke/ssh_config v1.2.0
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
-	github.com/kevinburke/ssh_config v1.2.0 // indirect
 	github.com/pjbgf/sha1cd v0.3.0 // indirect
 	github.com/sergi/go-diff v1.1.0 // indirect
 	github.com/skeema/knownhosts v1.2.1 // indirect
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Board shows the status of several concurrent operations, one line each.
+//
+// On a terminal, the lines are redrawn in place. Otherwise, each status
+// change is printed as a new line so that logs remain readable.
+type Board struct {
+	mutex sync.Mutex
+	out   io.Writer
+	tty   bool
+	keys  []string
+	lines map[string]string
+	drawn int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewBoard returns a board that writes to stderr.
+func NewBoard() *Board {
+	b := &Board{
+		out:   os.Stderr,
+		tty:   Enabled && term.IsTerminal(int(os.Stderr.Fd())),
+		lines: make(map[string]string),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	if !b.tty {
+		close(b.done)
+		return b
+	}
+
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.mutex.Lock()
+				b.draw()
+				b.mutex.Unlock()
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// Set sets the status line of `key`, adding it to the bottom of the board if
+// it's new.
+func (b *Board) Set(key string, line string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	old, ok := b.lines[key]
+	if !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.lines[key] = line
+
+	if Enabled && !b.tty && old != line {
+		fmt.Fprintln(b.out, line)
+	}
+}
+
+// Done draws the final status of every line and stops redrawing them.
+func (b *Board) Done() {
+	if b.tty {
+		close(b.stop)
+	}
+	<-b.done
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.tty {
+		b.draw()
+	}
+}
+
+func (b *Board) draw() {
+	var sb strings.Builder
+	if b.drawn > 0 {
+		// Move back to the first line that was drawn
+		fmt.Fprintf(&sb, "\033[%dF", b.drawn)
+	}
+	for _, key := range b.keys {
+		// Clear the rest of the line in case the status got shorter
+		fmt.Fprintf(&sb, "%s\033[K\n", b.lines[key])
+	}
+	b.drawn = len(b.keys)
+	fmt.Fprint(b.out, sb.String())
+}
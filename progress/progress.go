@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+// Package progress reports the progress of long-running operations, such as
+// downloading an index or walking a source tree, on the terminal.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"golang.org/x/term"
+)
+
+var (
+	// Enabled controls whether progress is reported at all. `--quiet` turns
+	// it off, and so should any command that prints machine-readable output.
+	// Reporters are also silent when stderr is not a terminal, and a Board
+	// then prints plain lines instead of redrawing.
+	Enabled = true
+)
+
+// Reporter reports the progress of a single operation until Done is called.
+// It is safe to call Add from multiple goroutines.
+type Reporter struct {
+	label string
+	noun  string
+	bytes bool
+	total int64
+	cur   atomic.Int64
+	s     *spinner.Spinner
+}
+
+func newReporter(r *Reporter) *Reporter {
+	if !Enabled || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return r
+	}
+
+	r.s = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriterFile(os.Stderr))
+	r.s.Prefix = " "
+	r.s.PreUpdate = func(s *spinner.Spinner) {
+		s.Suffix = "  " + r.String()
+	}
+	r.s.Start()
+	return r
+}
+
+// NewBytes reports the progress of transferring `total` bytes. `total` may be
+// zero or negative if it's unknown, e.g. when there is no Content-Length.
+func NewBytes(label string, total int64) *Reporter {
+	return newReporter(&Reporter{label: label, bytes: true, total: total})
+}
+
+// NewCount reports the number of `noun`s processed so far.
+func NewCount(label string, noun string) *Reporter {
+	return newReporter(&Reporter{label: label, noun: noun})
+}
+
+// Add adds `n` to the progress.
+func (r *Reporter) Add(n int64) {
+	r.cur.Add(n)
+}
+
+// Reader returns a reader that adds the bytes read from `rd` to the progress.
+func (r *Reporter) Reader(rd io.Reader) io.Reader {
+	return &reader{r: rd, rep: r}
+}
+
+// Done stops reporting the progress.
+func (r *Reporter) Done() {
+	if r.s != nil {
+		r.s.Stop()
+	}
+}
+
+func (r *Reporter) String() string {
+	cur := r.cur.Load()
+
+	if !r.bytes {
+		return fmt.Sprintf("%s: %d %s", r.label, cur, r.noun)
+	} else if r.total <= 0 {
+		return fmt.Sprintf("%s: %s", r.label, humanBytes(cur))
+	} else {
+		return fmt.Sprintf("%s: %s / %s (%d%%)", r.label, humanBytes(cur), humanBytes(r.total), cur*100/r.total)
+	}
+}
+
+type reader struct {
+	r   io.Reader
+	rep *Reporter
+}
+
+func (r *reader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.rep.Add(int64(n))
+	return
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
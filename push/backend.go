@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"fmt"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/config"
+)
+
+// Backend is where packages are built, such as the Solus build server.
+type Backend interface {
+	// Submit publishes `pkg` to be built and returns the job building it.
+	Submit(pkg common.Package) (Job, error)
+	// Query returns the current state of the job `id`.
+	Query(id int) (Job, error)
+	// Cancel cancels the job `id` if it hasn't finished yet.
+	Cancel(id int) error
+	// List returns the recent jobs of the backend.
+	List() ([]Job, error)
+}
+
+// TierFinisher is implemented by the backends that need to do something
+// once all the packages of a tier are built, before the next tier is
+// published.
+type TierFinisher interface {
+	FinishTier(results []Result) error
+}
+
+// NewBackend returns the backend configured by `cfg`.
+func NewBackend(cfg config.BackendConfig) (backend Backend, err error) {
+	cfg = cfg.WithDefaults()
+
+	switch cfg.Kind {
+	case "ssh":
+		backend = &SSHBackend{User: cfg.User, Host: cfg.Host}
+	case "local":
+		backend = NewLocalBackend(cfg)
+	case "fake":
+		fake := NewFakeBackend(cfg.Fail...)
+		fake.Script = cfg.Script
+		backend = fake
+	default:
+		err = fmt.Errorf("Unknown backend kind %s", cfg.Kind)
+	}
+	return
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/GZGavinZhao/autobuild/common"
+)
+
+// testPackage returns a package of the recipe `source` at version 1.0-1, which
+// is the split node of `names` if any are given.
+func testPackage(source string, names ...string) common.Package {
+	if len(names) == 0 {
+		names = []string{source}
+	}
+	return common.Package{
+		Path:    "/packages/" + source,
+		Source:  source,
+		Names:   names,
+		Version: "1.0",
+		Release: 1,
+	}
+}
+
+// waitJob queries the job `id` of `backend` until it's done, failing the test
+// if it takes more than `max` queries or ever moves backwards.
+func waitJob(t *testing.T, backend Backend, id int, max int) (job Job) {
+	t.Helper()
+
+	for i := 0; i < max; i++ {
+		cur, err := backend.Query(id)
+		if err != nil {
+			t.Fatalf("Query(%d) failed: %s", id, err)
+		}
+		if cur.ID != id {
+			t.Fatalf("Query(%d) returned job %d", id, cur.ID)
+		}
+		if cur.IsBehind(job) {
+			t.Errorf("Job %d moved back from %s to %s", id, job.Status, cur.Status)
+		}
+		if job = cur; job.IsDone() {
+			return
+		}
+	}
+	t.Fatalf("Job %d is still %s after %d queries", id, job.Status, max)
+	return
+}
+
+// testBackendContract checks the behaviour that push relies on from every
+// backend, with `backend` expected to build `ok` and fail to build `failed`.
+func testBackendContract(t *testing.T, backend Backend, ok common.Package, failed common.Package) {
+	t.Run("submit", func(t *testing.T) {
+		seen := make(map[int]bool)
+		for _, pkg := range []common.Package{ok, failed} {
+			job, err := backend.Submit(pkg)
+			if err != nil {
+				t.Fatalf("Submit(%s) failed: %s", pkg.Source, err)
+			}
+			if job.ID <= 0 || seen[job.ID] {
+				t.Errorf("Submit(%s) returned job ID %d, want a new positive ID", pkg.Source, job.ID)
+			}
+			seen[job.ID] = true
+
+			if job.Tag != BuildTag(pkg) {
+				t.Errorf("Submit(%s) returned tag %s, want %s", pkg.Source, job.Tag, BuildTag(pkg))
+			}
+			if !job.IsKnown() || job.IsDone() {
+				t.Errorf("Submit(%s) returned a job that is %s", pkg.Source, job.Status)
+			}
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		tests := []struct {
+			pkg    common.Package
+			status string
+		}{
+			{ok, StatusOK},
+			{failed, StatusFailed},
+		}
+
+		for _, tt := range tests {
+			job, err := backend.Submit(tt.pkg)
+			if err != nil {
+				t.Fatalf("Submit(%s) failed: %s", tt.pkg.Source, err)
+			}
+
+			job = waitJob(t, backend, job.ID, 10)
+			if job.Status != tt.status {
+				t.Errorf("Job of %s finished as %s, want %s", tt.pkg.Source, job.Status, tt.status)
+			}
+			if job.Finished == nil {
+				t.Errorf("Job of %s finished without a finish time", tt.pkg.Source)
+			}
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		job, err := backend.Submit(ok)
+		if err != nil {
+			t.Fatalf("Submit(%s) failed: %s", ok.Source, err)
+		}
+		if err = backend.Cancel(job.ID); err != nil {
+			t.Fatalf("Cancel(%d) failed: %s", job.ID, err)
+		}
+
+		if job, err = backend.Query(job.ID); err != nil {
+			t.Fatalf("Query(%d) failed: %s", job.ID, err)
+		}
+		if job.Status != StatusCancelled {
+			t.Errorf("Cancelled job %d is %s", job.ID, job.Status)
+		}
+
+		// Cancelling a finished job does nothing
+		if err = backend.Cancel(job.ID); err != nil {
+			t.Errorf("Cancel(%d) of a finished job failed: %s", job.ID, err)
+		}
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		if _, err := backend.Query(1 << 20); err == nil {
+			t.Error("Query() of an unknown job succeeded")
+		}
+		if err := backend.Cancel(1 << 20); err == nil {
+			t.Error("Cancel() of an unknown job succeeded")
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		job, err := backend.Submit(ok)
+		if err != nil {
+			t.Fatalf("Submit(%s) failed: %s", ok.Source, err)
+		}
+
+		jobs, err := backend.List()
+		if err != nil {
+			t.Fatalf("List() failed: %s", err)
+		}
+		if !slices.ContainsFunc(jobs, func(j Job) bool { return j.ID == job.ID && j.Tag == job.Tag }) {
+			t.Errorf("List() doesn't have the submitted job %d", job.ID)
+		}
+	})
+}
+
+func TestFakeBackendContract(t *testing.T) {
+	testBackendContract(t, NewFakeBackend("bar"), testPackage("foo"), testPackage("bar"))
+}
+
+func TestFakeBackendScript(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	backend := NewFakeBackend()
+	backend.Now = func() time.Time { return now }
+	backend.Script = map[string][]string{
+		"foo": {StatusBuilding, "ERROR", StatusUnclaimed, "WAITING", StatusOK},
+	}
+
+	job, err := backend.Submit(testPackage("foo"))
+	if err != nil {
+		t.Fatalf("Submit() failed: %s", err)
+	}
+
+	tests := []struct {
+		status string
+		err    bool
+	}{
+		{StatusBuilding, false},
+		{"", true},
+		{StatusUnclaimed, false},
+		{"WAITING", false},
+		{StatusOK, false},
+		// The last status sticks
+		{StatusOK, false},
+	}
+
+	for idx, tt := range tests {
+		cur, err := backend.Query(job.ID)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Query %d succeeded, want an error", idx+1)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Query %d failed: %s", idx+1, err)
+		}
+		if cur.Status != tt.status {
+			t.Errorf("Query %d returned %s, want %s", idx+1, cur.Status, tt.status)
+		}
+		if cur.IsDone() && (cur.Finished == nil || !cur.Finished.Equal(now)) {
+			t.Errorf("Query %d returned finish time %v, want %v", idx+1, cur.Finished, now)
+		}
+	}
+}
+
+func TestFakeBackendLog(t *testing.T) {
+	backend := NewFakeBackend("bar")
+
+	tests := []struct {
+		pkg     common.Package
+		failure bool
+	}{
+		{testPackage("foo"), false},
+		{testPackage("bar"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pkg.Source, func(t *testing.T) {
+			job, err := backend.Submit(tt.pkg)
+			if err != nil {
+				t.Fatalf("Submit() failed: %s", err)
+			}
+			waitJob(t, backend, job.ID, 10)
+
+			log, err := backend.Log(job.ID)
+			if err != nil {
+				t.Fatalf("Log(%d) failed: %s", job.ID, err)
+			}
+			if !bytes.Contains(log, []byte(job.Tag)) {
+				t.Errorf("Log of job %d doesn't mention %s:\n%s", job.ID, job.Tag, log)
+			}
+			if failure := bytes.Contains(log, []byte("error:")); failure != tt.failure {
+				t.Errorf("Log of job %d has a failure: %t, want %t:\n%s", job.ID, failure, tt.failure, log)
+			}
+		})
+	}
+}
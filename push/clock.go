@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells and waits for time, so that polling can be driven by a fake
+// clock instead of the real one.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time        { return time.Now() }
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// SystemClock is the real clock.
+var SystemClock Clock = systemClock{}
+
+// FakeClock is a clock that only moves when slept on or advanced, so that
+// sleeping returns immediately.
+type FakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+	slept []time.Duration
+}
+
+// NewFakeClock returns a fake clock starting at `now`.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	c.slept = append(c.slept, d)
+}
+
+// Advance moves the clock forward by `d` without recording a sleep.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Slept returns the durations slept on the clock so far, in order.
+func (c *FakeClock) Slept() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]time.Duration(nil), c.slept...)
+}
@@ -13,16 +13,39 @@ import (
 
 	"github.com/GZGavinZhao/autobuild/common"
 	"github.com/go-git/go-git/v5"
-	// "github.com/go-git/go-git/v5/config"
-	// "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 )
 
-const (
-	user = "build-controller"
-	host = "build.getsol.us"
-)
+// SSHBackend publishes packages to the build controller of the Solus build
+// server, which is driven through ssh and answers in JSON.
+type SSHBackend struct {
+	User string
+	Host string
+}
 
-func Publish(pkg common.Package, prePush bool) (job Job, err error) {
+// run runs the controller command `args` and returns its output.
+func (b *SSHBackend) run(args ...string) (output []byte, err error) {
+	args = append([]string{fmt.Sprintf("%s@%s", b.User, b.Host)}, args...)
+	cmd := exec.Command("ssh", args...)
+	if output, err = cmd.Output(); err != nil {
+		err = fmt.Errorf("ssh command %q failed: %w", args, err)
+	}
+	return
+}
+
+// ssh runs the controller command `args` and decodes its JSON output into
+// `v`, unless `v` is nil.
+func (b *SSHBackend) ssh(v any, args ...string) (err error) {
+	output, err := b.run(args...)
+	if err != nil || v == nil {
+		return
+	}
+	if err = json.Unmarshal(output, v); err != nil {
+		return fmt.Errorf("Failed to unmarshall json output of %q: %w", args, err)
+	}
+	return
+}
+
+func (b *SSHBackend) Submit(pkg common.Package) (job Job, err error) {
 	root := pkg.Root
 	relp, err := filepath.Rel(root, pkg.Path)
 	if err != nil {
@@ -48,100 +71,44 @@ func Publish(pkg common.Package, prePush bool) (job Job, err error) {
 		return
 	}
 
-	// br, err := repo.Branch(ref.Name().Short())
-	// if err != nil {
-	// 	err = fmt.Errorf("push.Publish: failed to get branch of HEAD: %w", err)
-	// 	return
-	// }
-
-	// rm, err := repo.Remote(br.Remote)
-	// if err != nil {
-	// 	err = fmt.Errorf("push.Publish: failed to get remote of branch %s: %w", br.Name, err)
-	// 	return
-	// }
-
-	// localRef := ref.Name().String()
-	// remoteRef := fmt.Sprintf("refs/remotes/%s/%s", rm.Config().Name, br.Name)
-	// refspec := config.RefSpec(fmt.Sprintf("+%s:%s", localRef, remoteRef))
-	// if err = refspec.Validate(); err != nil {
-	// 	err = fmt.Errorf("push.Publish: failed to validate refspec %s: %w", refspec.String(), err)
-	// 	return
-	// }
-
-	// sshKeyPath, ok := os.LookupEnv("AUTOBUILD_SSHKEY")
-	// var auth *ssh.PublicKeys
-	// if ok {
-	// 	auth, err = ssh.NewPublicKeysFromFile("git", sshKeyPath, "")
-	// 	if err != nil {
-	// 		err = fmt.Errorf("push.Publish: failed to obtain ssh private key from %s: %w", sshKeyPath, err)
-	// 		return
-	// 	}
-	// 	println("Picked up key", sshKeyPath, auth.String())
-	// }
-
-	// println("Pushing to remote", rm.Config().Name, rm.Config().URLs)
-	// err = rm.Push(&git.PushOptions{
-	// 	RemoteName: rm.Config().Name,
-	// 	RefSpecs:   []config.RefSpec{refspec},
-	// 	Auth:       auth,
-	// })
-	// if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
-	// 	err = fmt.Errorf("push.Publish: failed to push to remote %s: %w", rm.Config().Name, err)
-	// 	return
-	// }
-
-	// go-git cannot pick up the correct user/SSH public key to push! Bruh!
-	var output []byte
-	if prePush {
-		pushCmd := exec.Command("git", "push")
-		pushCmd.Dir = pkg.Root
-		if output, err = pushCmd.CombinedOutput(); err != nil {
-			err = fmt.Errorf("push.Publish: failed to push to remote: %w, stderr: %s", err, string(output))
-			return
-		}
-	}
-
-	args := []string{
-		fmt.Sprintf("%s@%s", user, host),
+	err = b.ssh(&job,
 		"build",
-		pkg.Name,
-		fmt.Sprintf("%s-%s-%d", pkg.Name, pkg.Version, pkg.Release),
+		SourceName(pkg),
+		BuildTag(pkg),
 		relp,
 		ref.Hash().String(),
 		"YnkgYXV0b2J1aWxk", // "by autobuild"
+	)
+	if err != nil {
+		err = fmt.Errorf("push.Publish: failed to publish package %s: %w", SourceName(pkg), err)
 	}
-	cmd := exec.Command("ssh", args...)
-	if output, err = cmd.Output(); err != nil {
-		err = fmt.Errorf("push.Publish: failed to publish package %s using args %q: %w", pkg.Name, args, err)
-		return
-	}
+	return
+}
 
-	if err = json.Unmarshal(output, &job); err != nil {
-		err = fmt.Errorf("push.Publish: failed to unmarshall json output to job: %w", err)
-		return
+func (b *SSHBackend) Query(jobid int) (job Job, err error) {
+	if err = b.ssh(&job, "query", fmt.Sprint(jobid)); err != nil {
+		err = fmt.Errorf("Failed to query job %d: %w", jobid, err)
 	}
-
 	return
 }
 
-func Query(jobid int) (job Job, err error) {
-	args := []string{
-		fmt.Sprintf("%s@%s", user, host),
-		"query",
-		fmt.Sprint(jobid),
-	}
-	cmd := exec.Command("ssh", args...)
-	output, err := cmd.Output()
-	if err != nil {
-		err = fmt.Errorf("Failed to query job %d using args %q: %w", jobid, args, err)
-		return
+func (b *SSHBackend) Cancel(jobid int) (err error) {
+	if err = b.ssh(nil, "cancel", fmt.Sprint(jobid)); err != nil {
+		err = fmt.Errorf("Failed to cancel job %d: %w", jobid, err)
 	}
+	return
+}
 
-	err = json.Unmarshal(output, &job)
-	if err != nil {
-		err = fmt.Errorf("Failed to unmarshall json output to job: %w", err)
-		return
+func (b *SSHBackend) List() (jobs []Job, err error) {
+	if err = b.ssh(&jobs, "list"); err != nil {
+		err = fmt.Errorf("Failed to list jobs: %w", err)
 	}
+	return
+}
 
+func (b *SSHBackend) Log(jobid int) (log []byte, err error) {
+	if log, err = b.run("log", fmt.Sprint(jobid)); err != nil {
+		err = fmt.Errorf("Failed to fetch build log of job %d: %w", jobid, err)
+	}
 	return
 }
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/GZGavinZhao/autobuild/common"
+)
+
+// FakeBackend pretends to build packages, for exercising push without a
+// build server. Every time a job is queried, it moves one status forward,
+// from UNCLAIMED to CLAIMED, BUILDING and finally OK, or FAILED for the
+// sources that it's asked to fail.
+type FakeBackend struct {
+	// Now returns the current time, time.Now by default.
+	Now func() time.Time
+	// Script, if it has a source, is the statuses that the successive queries
+	// of its jobs return instead, where the last one sticks. The status
+	// `ERROR` makes the query fail.
+	Script map[string][]string
+
+	mutex sync.Mutex
+	fail  []string
+	jobs  []Job
+	steps []int
+}
+
+// NewFakeBackend returns a fake backend that fails to build `fail`.
+func NewFakeBackend(fail ...string) *FakeBackend {
+	return &FakeBackend{Now: time.Now, fail: fail}
+}
+
+func (b *FakeBackend) Submit(pkg common.Package) (job Job, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	path := pkg.Path
+	job = Job{
+		ID:     len(b.jobs) + 1,
+		Pkg:    SourceName(pkg),
+		Tag:    BuildTag(pkg),
+		Status: StatusUnclaimed,
+		Path:   &path,
+	}
+	b.jobs = append(b.jobs, job)
+	b.steps = append(b.steps, 0)
+	return
+}
+
+func (b *FakeBackend) get(id int) (job *Job, err error) {
+	if id < 1 || id > len(b.jobs) {
+		err = fmt.Errorf("No job with ID %d", id)
+		return
+	}
+	job = &b.jobs[id-1]
+	return
+}
+
+func (b *FakeBackend) Query(id int) (job Job, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	cur, err := b.get(id)
+	if err != nil {
+		return
+	}
+
+	if script, ok := b.Script[cur.Pkg]; ok && len(script) > 0 && !cur.IsDone() {
+		step := min(b.steps[id-1], len(script)-1)
+		b.steps[id-1]++
+		if script[step] == "ERROR" {
+			err = fmt.Errorf("Failed to query job %d: scripted error", id)
+			return
+		}
+
+		cur.Status = script[step]
+		cur.Builder = "fake"
+		if cur.IsDone() {
+			finished := b.Now()
+			cur.Finished = &finished
+		}
+		job = *cur
+		return
+	}
+
+	switch cur.Status {
+	case StatusUnclaimed:
+		cur.Status = StatusClaimed
+		cur.Builder = "fake"
+	case StatusClaimed:
+		cur.Status = StatusBuilding
+	case StatusBuilding:
+		cur.Status = StatusOK
+		if slices.Contains(b.fail, cur.Pkg) {
+			cur.Status = StatusFailed
+		}
+		finished := b.Now()
+		cur.Finished = &finished
+	}
+
+	job = *cur
+	return
+}
+
+func (b *FakeBackend) Cancel(id int) (err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	job, err := b.get(id)
+	if err != nil || job.IsDone() {
+		return
+	}
+	job.Status = StatusCancelled
+	finished := b.Now()
+	job.Finished = &finished
+	return
+}
+
+func (b *FakeBackend) List() (jobs []Job, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	jobs = slices.Clone(b.jobs)
+	return
+}
+
+func (b *FakeBackend) Log(id int) (log []byte, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	job, err := b.get(id)
+	if err != nil {
+		return
+	}
+
+	log = fmt.Appendf(nil, "Pretending to build %s\n", job.Tag)
+	if job.Status == StatusFailed {
+		log = fmt.Appendf(log, "src/%s.c:1:1: error: this is a fake failure\nmake: *** [Makefile:1: all] Error 1\n", job.Pkg)
+	}
+	return
+}
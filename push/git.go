@@ -0,0 +1,245 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+)
+
+// SSHConfig is where the User and IdentityFile of ssh remotes are looked up,
+// `~/.ssh/config` and `/etc/ssh/ssh_config` by default. go-git itself looks
+// up their Hostname and Port.
+var SSHConfig interface {
+	Get(alias string, key string) string
+	GetAll(alias string, key string) []string
+} = ssh_config.DefaultUserSettings
+
+// defaultKeys are the private keys in `~/.ssh` that ssh tries by default.
+var defaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// RefUpdate is a ref that was updated on a remote by GitPush.
+type RefUpdate struct {
+	Ref string
+	// Old is the hash of the ref on the remote before the push, as of the
+	// last fetch or push. It's zero if the ref is new.
+	Old plumbing.Hash
+	New plumbing.Hash
+}
+
+func (u RefUpdate) String() string {
+	if u.Old.IsZero() {
+		return fmt.Sprintf("%s (new) -> %s", u.Ref, u.New.String()[:8])
+	}
+	return fmt.Sprintf("%s %s..%s", u.Ref, u.Old.String()[:8], u.New.String()[:8])
+}
+
+// GitPushResult is what GitPush pushed.
+type GitPushResult struct {
+	Remote string
+	URL    string
+	// Updated is empty if the remote was already up to date.
+	Updated []RefUpdate
+}
+
+// PushRejectedError is returned when the remote refuses to update a ref, e.g.
+// because the update is not a fast-forward.
+type PushRejectedError struct {
+	Remote string
+	// Ref is empty if the remote rejected the whole push.
+	Ref    string
+	Reason string
+}
+
+func (e PushRejectedError) Error() string {
+	if len(e.Ref) == 0 {
+		return fmt.Sprintf("Remote %s rejected the push: %s", e.Remote, e.Reason)
+	}
+	return fmt.Sprintf("Remote %s rejected %s: %s", e.Remote, e.Ref, e.Reason)
+}
+
+var (
+	// go-git only reports rejections as strings
+	nonFastForwardRe = regexp.MustCompile(`^non-fast-forward update: (\S+)$`)
+	commandErrorRe   = regexp.MustCompile(`^command error on (\S+): (.*)$`)
+	unpackErrorRe    = regexp.MustCompile(`^unpack error: (.*)$`)
+)
+
+// GitPush pushes the current branch of the recipe repository at `root` to its
+// upstream branch, so that the build server can see the commits to build.
+//
+// ssh remotes are authenticated like ssh would, with the key in
+// $AUTOBUILD_SSHKEY if set, see SSHAuth.
+func GitPush(root string) (res GitPushResult, err error) {
+	repo, err := git.PlainOpen(root)
+	if err != nil {
+		err = fmt.Errorf("Failed to open git repository at %s: %w", root, err)
+		return
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		err = fmt.Errorf("Failed to get HEAD of repository at %s: %w", root, err)
+		return
+	}
+	if !head.Name().IsBranch() {
+		err = fmt.Errorf("HEAD of repository at %s is detached, not on a branch", root)
+		return
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		err = fmt.Errorf("Failed to read config of repository at %s: %w", root, err)
+		return
+	}
+
+	// Push to the upstream branch, or the branch of the same name on origin
+	res.Remote = "origin"
+	merge := head.Name()
+	if branch, ok := cfg.Branches[head.Name().Short()]; ok && len(branch.Remote) > 0 {
+		res.Remote = branch.Remote
+		if len(branch.Merge) > 0 {
+			merge = branch.Merge
+		}
+	}
+
+	remote, err := repo.Remote(res.Remote)
+	if err != nil {
+		err = fmt.Errorf("Failed to get remote %s of repository at %s: %w", res.Remote, root, err)
+		return
+	}
+	if len(remote.Config().URLs) == 0 {
+		err = fmt.Errorf("Remote %s of repository at %s has no URL", res.Remote, root)
+		return
+	}
+	res.URL = remote.Config().URLs[0]
+
+	endpoint, err := transport.NewEndpoint(res.URL)
+	if err != nil {
+		err = fmt.Errorf("Invalid URL %s of remote %s: %w", res.URL, res.Remote, err)
+		return
+	}
+
+	var auth transport.AuthMethod
+	if endpoint.Protocol == "ssh" {
+		if auth, err = SSHAuth(endpoint); err != nil {
+			return
+		}
+		waterlog.Debugf("GitPush: authenticating to %s with %s\n", endpoint.Host, auth)
+	}
+
+	update := RefUpdate{Ref: merge.String(), New: head.Hash()}
+	if tracking, err := repo.Reference(plumbing.NewRemoteReferenceName(res.Remote, merge.Short()), true); err == nil {
+		update.Old = tracking.Hash()
+	}
+
+	refspec := config.RefSpec(fmt.Sprintf("%s:%s", head.Name(), merge))
+	err = remote.Push(&git.PushOptions{
+		RemoteName: res.Remote,
+		RefSpecs:   []config.RefSpec{refspec},
+		Auth:       auth,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		err = nil
+		return
+	} else if err != nil {
+		err = pushError(res.Remote, err)
+		return
+	}
+
+	res.Updated = append(res.Updated, update)
+	return
+}
+
+// pushError turns the rejections reported by the remote into a
+// PushRejectedError.
+func pushError(remote string, err error) error {
+	if match := nonFastForwardRe.FindStringSubmatch(err.Error()); match != nil {
+		return PushRejectedError{Remote: remote, Ref: match[1], Reason: "non-fast-forward update, pull or rebase first"}
+	}
+	if match := commandErrorRe.FindStringSubmatch(err.Error()); match != nil {
+		return PushRejectedError{Remote: remote, Ref: match[1], Reason: match[2]}
+	}
+	if match := unpackErrorRe.FindStringSubmatch(err.Error()); match != nil {
+		return PushRejectedError{Remote: remote, Reason: "unpack error: " + match[1]}
+	}
+	return fmt.Errorf("Failed to push to remote %s: %w", remote, err)
+}
+
+// SSHAuth returns how to authenticate to the ssh remote `endpoint`, trying in
+// order:
+//
+//  1. the private key in $AUTOBUILD_SSHKEY, with the passphrase in
+//     $AUTOBUILD_SSHKEY_PASSPHRASE if any,
+//  2. the IdentityFile of the host in SSHConfig, if it has no passphrase,
+//  3. ssh-agent, if $SSH_AUTH_SOCK is set, and
+//  4. the default private keys in `~/.ssh`, if they have no passphrase.
+//
+// The user is the one of the URL, else the User of the host in SSHConfig,
+// else `git`.
+func SSHAuth(endpoint *transport.Endpoint) (auth transport.AuthMethod, err error) {
+	user := endpoint.User
+	if len(user) == 0 {
+		user = SSHConfig.Get(endpoint.Host, "User")
+	}
+	if len(user) == 0 {
+		user = "git"
+	}
+
+	if key, ok := os.LookupEnv("AUTOBUILD_SSHKEY"); ok {
+		if auth, err = ssh.NewPublicKeysFromFile(user, key, os.Getenv("AUTOBUILD_SSHKEY_PASSPHRASE")); err != nil {
+			err = fmt.Errorf("Failed to load ssh key %s from AUTOBUILD_SSHKEY: %w", key, err)
+		}
+		return
+	}
+
+	home, _ := os.UserHomeDir()
+	expand := func(path string) string {
+		if strings.HasPrefix(path, "~/") {
+			return filepath.Join(home, path[2:])
+		}
+		return path
+	}
+
+	for _, identity := range SSHConfig.GetAll(endpoint.Host, "IdentityFile") {
+		if identity == ssh_config.Default("IdentityFile") {
+			continue
+		}
+		if keys, err := ssh.NewPublicKeysFromFile(user, expand(identity), ""); err == nil {
+			return keys, nil
+		} else {
+			waterlog.Debugf("SSHAuth: skipping IdentityFile %s: %s\n", identity, err)
+		}
+	}
+
+	if len(os.Getenv("SSH_AUTH_SOCK")) > 0 {
+		if agent, err := ssh.NewSSHAgentAuth(user); err == nil {
+			return agent, nil
+		} else {
+			waterlog.Debugf("SSHAuth: failed to connect to ssh-agent: %s\n", err)
+		}
+	}
+
+	for _, key := range defaultKeys {
+		if keys, err := ssh.NewPublicKeysFromFile(user, filepath.Join(home, ".ssh", key), ""); err == nil {
+			return keys, nil
+		}
+	}
+
+	err = fmt.Errorf("No usable ssh key found for %s@%s, start ssh-agent or set AUTOBUILD_SSHKEY", user, endpoint.Host)
+	return
+}
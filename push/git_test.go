@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// testRepo creates a repository in a temporary directory with a commit of
+// `file` and the bare repository `remote` as the upstream of its master
+// branch.
+func testRepo(t *testing.T, remote string, file string) (root string, head plumbing.Hash) {
+	t.Helper()
+
+	root = t.TempDir()
+	repo, err := git.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %s", err)
+	}
+
+	if err = os.WriteFile(filepath.Join(root, file), []byte(file), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %s", file, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Failed to get worktree: %s", err)
+	}
+	if _, err = worktree.Add(file); err != nil {
+		t.Fatalf("Failed to add %s: %s", file, err)
+	}
+	head, err = worktree.Commit("Add "+file, &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit %s: %s", file, err)
+	}
+
+	if _, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remote}}); err != nil {
+		t.Fatalf("Failed to create remote: %s", err)
+	}
+	err = repo.CreateBranch(&config.Branch{Name: "master", Remote: "origin", Merge: plumbing.NewBranchReferenceName("master")})
+	if err != nil {
+		t.Fatalf("Failed to set upstream branch: %s", err)
+	}
+	return
+}
+
+func TestGitPush(t *testing.T) {
+	remoteDir := t.TempDir()
+	remote, err := git.PlainInit(remoteDir, true)
+	if err != nil {
+		t.Fatalf("Failed to create remote repository: %s", err)
+	}
+
+	root, head := testRepo(t, remoteDir, "package.yml")
+
+	t.Run("push", func(t *testing.T) {
+		res, err := GitPush(root)
+		if err != nil {
+			t.Fatalf("GitPush() failed: %s", err)
+		}
+		if res.Remote != "origin" || res.URL != remoteDir {
+			t.Errorf("GitPush() pushed to %s (%s), want origin (%s)", res.Remote, res.URL, remoteDir)
+		}
+
+		want := RefUpdate{Ref: "refs/heads/master", New: head}
+		if len(res.Updated) != 1 || res.Updated[0] != want {
+			t.Errorf("GitPush() updated %v, want %v", res.Updated, want)
+		}
+
+		ref, err := remote.Reference(plumbing.NewBranchReferenceName("master"), true)
+		if err != nil {
+			t.Fatalf("Remote has no master branch: %s", err)
+		}
+		if ref.Hash() != head {
+			t.Errorf("Remote master is at %s, want %s", ref.Hash(), head)
+		}
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		res, err := GitPush(root)
+		if err != nil {
+			t.Fatalf("GitPush() failed: %s", err)
+		}
+		if len(res.Updated) > 0 {
+			t.Errorf("GitPush() updated %v, want nothing", res.Updated)
+		}
+	})
+
+	t.Run("non-fast-forward", func(t *testing.T) {
+		// Another repository whose history diverged from the remote's
+		other, _ := testRepo(t, remoteDir, "stone.yaml")
+
+		_, err := GitPush(other)
+		var rejected PushRejectedError
+		if !errors.As(err, &rejected) {
+			t.Fatalf("GitPush() returned %v, want a PushRejectedError", err)
+		}
+		if rejected.Remote != "origin" || rejected.Ref != "refs/heads/master" {
+			t.Errorf("GitPush() was rejected by %s for %s, want origin for refs/heads/master", rejected.Remote, rejected.Ref)
+		}
+
+		ref, err := remote.Reference(plumbing.NewBranchReferenceName("master"), true)
+		if err != nil {
+			t.Fatalf("Remote has no master branch: %s", err)
+		}
+		if ref.Hash() != head {
+			t.Errorf("Remote master moved to %s, want it at %s", ref.Hash(), head)
+		}
+	})
+}
@@ -8,6 +8,15 @@ import (
 	"time"
 )
 
+const (
+	StatusUnclaimed = "UNCLAIMED"
+	StatusClaimed   = "CLAIMED"
+	StatusBuilding  = "BUILDING"
+	StatusOK        = "OK"
+	StatusFailed    = "FAILED"
+	StatusCancelled = "CANCELLED"
+)
+
 type Job struct {
 	ID       int        `json:"id"`
 	Pkg      string     `json:"pkg"`
@@ -18,3 +27,34 @@ type Job struct {
 	Path     *string    `json:"path,omitempty"`
 	Ref      *string    `json:"ref,omitempty"`
 }
+
+// statusRanks orders the statuses that the build server knows of by how far
+// a job has come. All the final statuses have the same rank.
+var statusRanks = map[string]int{
+	StatusUnclaimed: 0,
+	StatusClaimed:   1,
+	StatusBuilding:  2,
+	StatusOK:        3,
+	StatusFailed:    3,
+	StatusCancelled: 3,
+}
+
+// IsKnown returns whether the status of the job is one that autobuild knows.
+func (j Job) IsKnown() bool {
+	_, ok := statusRanks[j.Status]
+	return ok
+}
+
+// IsDone returns whether the job has finished, successfully or not. Jobs with
+// an unknown status are not done.
+func (j Job) IsDone() bool {
+	return j.Status == StatusOK || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// IsBehind returns whether `j` is at an earlier status than `other`, e.g. a
+// job that is UNCLAIMED again after its builder went away while BUILDING.
+func (j Job) IsBehind(other Job) bool {
+	rank, ok := statusRanks[j.Status]
+	otherRank, otherOk := statusRanks[other.Status]
+	return ok && otherOk && rank < otherRank
+}
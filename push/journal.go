@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/common"
+)
+
+const journalFile = "journal.json"
+
+// Entry is the state of a package planned to be pushed.
+type Entry struct {
+	Source  string    `json:"source"`
+	Names   []string  `json:"names"`
+	Tier    int       `json:"tier"`
+	Job     *Job      `json:"job,omitempty"`
+	Started time.Time `json:"started"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Matches returns whether `pkg` is the package (node) of the entry, or the
+// split nodes of a source merged with it, see MergeSplits.
+func (e *Entry) Matches(pkg common.Package) bool {
+	return e.Source == pkg.Source && len(e.Names) > 0 && slices.Contains(pkg.Names, e.Names[0])
+}
+
+// Journal records the plan and progress of a push session, so that an
+// interrupted or failed push can be resumed.
+type Journal struct {
+	Session string    `json:"session"`
+	Created time.Time `json:"created"`
+	// Backend is the kind of backend that the jobs were published to. Job
+	// IDs are only meaningful to that backend.
+	Backend string `json:"backend"`
+	// OldTPath and NewTPath are the tpaths that were diffed to find the
+	// packages to push.
+	OldTPath string  `json:"old"`
+	NewTPath string  `json:"new"`
+	Entries  []Entry `json:"entries"`
+
+	dir   string
+	mutex sync.Mutex
+}
+
+// SessionsDir returns the directory that push sessions are kept in, i.e.
+// `$XDG_CACHE_HOME/autobuild/sessions`.
+func SessionsDir() (dir string, err error) {
+	if dir, err = os.UserCacheDir(); err != nil {
+		err = fmt.Errorf("Failed to determine cache directory: %w", err)
+		return
+	}
+	dir = filepath.Join(dir, "autobuild", "sessions")
+	return
+}
+
+// NewJournal starts a new session for pushing `order` to the `backend` kind of
+// backend and saves its journal.
+func NewJournal(oldTPath string, newTPath string, backend string, order [][]common.Package) (j *Journal, err error) {
+	now := time.Now()
+	j = &Journal{
+		Created:  now,
+		Backend:  backend,
+		OldTPath: oldTPath,
+		NewTPath: newTPath,
+	}
+	for tierIdx, tier := range order {
+		for _, pkg := range tier {
+			j.Entries = append(j.Entries, Entry{Source: pkg.Source, Names: pkg.Names, Tier: tierIdx})
+		}
+	}
+
+	sessions, err := SessionsDir()
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(sessions, 0o755); err != nil {
+		err = fmt.Errorf("Failed to create sessions directory %s: %w", sessions, err)
+		return
+	}
+
+	// Sessions are named after when they are started, with a suffix if
+	// another one was started in the same second
+	name := now.Format("20060102-150405")
+	for n := 1; ; n++ {
+		j.Session = name
+		if n > 1 {
+			j.Session = fmt.Sprintf("%s-%d", name, n)
+		}
+		j.dir = filepath.Join(sessions, j.Session)
+		if err = os.Mkdir(j.dir, 0o755); !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("Failed to create session directory %s: %w", j.dir, err)
+		return
+	}
+
+	err = j.save()
+	return
+}
+
+// LoadJournal loads the journal of `session`.
+func LoadJournal(session string) (j *Journal, err error) {
+	// A session is a single directory under the sessions directory
+	if session == "" || session == "." || session == ".." || filepath.Base(session) != session {
+		err = fmt.Errorf("Invalid push session name %q", session)
+		return
+	}
+
+	sessions, err := SessionsDir()
+	if err != nil {
+		return
+	}
+
+	dir := filepath.Join(sessions, session)
+	raw, err := os.ReadFile(filepath.Join(dir, journalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		err = fmt.Errorf("No push session %s found in %s", session, sessions)
+		return
+	} else if err != nil {
+		return
+	}
+
+	j = &Journal{dir: dir}
+	if err = json.Unmarshal(raw, j); err != nil {
+		err = fmt.Errorf("Failed to decode journal of session %s: %w", session, err)
+	}
+	return
+}
+
+// ListSessions returns the journals of all push sessions, the oldest first.
+func ListSessions() (journals []*Journal, err error) {
+	sessions, err := SessionsDir()
+	if err != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(sessions)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		j, err := LoadJournal(entry.Name())
+		if err != nil {
+			waterlog.Warnf("Ignoring broken push session %s: %s\n", entry.Name(), err)
+			continue
+		}
+		journals = append(journals, j)
+	}
+
+	slices.SortFunc(journals, func(a, b *Journal) int {
+		return a.Created.Compare(b.Created)
+	})
+	return
+}
+
+// Dir returns the directory of the session.
+func (j *Journal) Dir() string {
+	return j.dir
+}
+
+// LogPath returns where the build log of job `id` of `source` is saved in the
+// session.
+func (j *Journal) LogPath(source string, id int) string {
+	return filepath.Join(j.dir, "logs", LogName(source, id))
+}
+
+// Order returns the packages of `pkgs` in the planned order of the session,
+// with split nodes merged like they were planned.
+func (j *Journal) Order(pkgs []common.Package) (order [][]common.Package, err error) {
+	for _, entry := range j.Entries {
+		// The entry may be for split nodes merged together, see PlanSources
+		var nodes []common.Package
+		for _, pkg := range pkgs {
+			if pkg.Source == entry.Source && len(pkg.Names) > 0 && slices.Contains(entry.Names, pkg.Names[0]) {
+				nodes = append(nodes, pkg)
+			}
+		}
+		if len(nodes) == 0 {
+			err = fmt.Errorf("Package %s of session %s is no longer found", entry.Source, j.Session)
+			return
+		}
+
+		pkg := nodes[0]
+		if len(nodes) > 1 {
+			pkg = MergeSplits(nodes)
+		}
+
+		for len(order) <= entry.Tier {
+			order = append(order, nil)
+		}
+		order[entry.Tier] = append(order[entry.Tier], pkg)
+	}
+	return
+}
+
+// Previous returns the recorded result of publishing `pkg`, if it was
+// published at all.
+func (j *Journal) Previous(pkg common.Package) (res Result, ok bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for _, entry := range j.Entries {
+		if !entry.Matches(pkg) || entry.Job == nil {
+			continue
+		}
+
+		res = Result{Package: pkg, Job: *entry.Job, Started: entry.Started}
+		if len(entry.Error) > 0 {
+			res.Err = errors.New(entry.Error)
+		}
+		ok = true
+		return
+	}
+	return
+}
+
+// Record records the latest result of publishing a package and saves the
+// journal.
+func (j *Journal) Record(res Result) (err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for idx := range j.Entries {
+		entry := &j.Entries[idx]
+		if !entry.Matches(res.Package) {
+			continue
+		}
+
+		if res.Job.ID != 0 {
+			job := res.Job
+			entry.Job = &job
+		}
+		entry.Started = res.Started
+		entry.Error = ""
+		if res.Err != nil {
+			entry.Error = res.Err.Error()
+		}
+	}
+
+	return j.save()
+}
+
+func (j *Journal) save() (err error) {
+	raw, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return
+	}
+
+	// Write to a temporary file first so that an interruption never leaves
+	// a broken journal behind.
+	tmp, err := os.CreateTemp(j.dir, journalFile+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(raw); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), filepath.Join(j.dir, journalFile))
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadJournalInvalidSession(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+
+	// A journal outside of the sessions directory that must not be loaded
+	outside := filepath.Join(cache, "autobuild", "x")
+	if err := os.MkdirAll(outside, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, journalFile), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, session := range []string{"", ".", "..", "../x", "a/b", "/tmp/x"} {
+		t.Run(session, func(t *testing.T) {
+			_, err := LoadJournal(session)
+			if err == nil || !strings.Contains(err.Error(), "Invalid push session name") {
+				t.Errorf("LoadJournal(%q) returned %v, want an invalid session name error", session, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/config"
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
+// LocalBackend builds packages on this machine by running a build command,
+// such as `solbuild build package.yml` or `boulder build stone.yaml`, in the
+// directory of each recipe.
+//
+// If a local repository is configured, the artefacts of each tier are added
+// to it once the tier is built, so that the next tier is built against them.
+type LocalBackend struct {
+	// LogDir is where the output of each build is saved, if set.
+	LogDir string
+
+	cfg config.BackendConfig
+
+	mutex sync.Mutex
+	jobs  []localJob
+}
+
+type localJob struct {
+	job     Job
+	cmd     *exec.Cmd
+	pkg     common.Package
+	started time.Time
+	log     string
+}
+
+// NewLocalBackend returns a local backend configured by `cfg`.
+func NewLocalBackend(cfg config.BackendConfig) *LocalBackend {
+	return &LocalBackend{cfg: cfg.WithDefaults()}
+}
+
+// buildCommand returns the command to build `pkg` with, depending on the
+// kind of its recipe.
+func (b *LocalBackend) buildCommand(pkg common.Package) []string {
+	if utils.PathExists(filepath.Join(pkg.Path, "stone.yaml")) {
+		return b.cfg.StoneCommand
+	}
+	return b.cfg.Command
+}
+
+func (b *LocalBackend) Submit(pkg common.Package) (job Job, err error) {
+	command := b.buildCommand(pkg)
+	if len(command) == 0 {
+		err = fmt.Errorf("No build command configured for the local backend")
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	path := pkg.Path
+	job = Job{
+		ID:      len(b.jobs) + 1,
+		Pkg:     SourceName(pkg),
+		Tag:     BuildTag(pkg),
+		Status:  StatusBuilding,
+		Builder: "local",
+		Path:    &path,
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = pkg.Path
+
+	var logFile *os.File
+	if len(b.LogDir) > 0 {
+		if err = os.MkdirAll(b.LogDir, 0o755); err != nil {
+			err = fmt.Errorf("Failed to create log directory %s: %w", b.LogDir, err)
+			return
+		}
+		if logFile, err = os.Create(filepath.Join(b.LogDir, LogName(pkg.Source, job.ID))); err != nil {
+			err = fmt.Errorf("Failed to create build log of %s: %w", pkg.Source, err)
+			return
+		}
+		fmt.Fprintf(logFile, "# %q in %s\n", command, pkg.Path)
+		cmd.Stdout, cmd.Stderr = logFile, logFile
+	}
+
+	// File systems may have coarse timestamps, see artefacts
+	started := time.Now().Truncate(time.Second)
+	if err = cmd.Start(); err != nil {
+		err = fmt.Errorf("Failed to start building %s with %q: %w", pkg.Source, command, err)
+		if logFile != nil {
+			logFile.Close()
+		}
+		return
+	}
+
+	b.jobs = append(b.jobs, localJob{job: job, cmd: cmd, pkg: pkg, started: started})
+	if logFile != nil {
+		b.jobs[len(b.jobs)-1].log = logFile.Name()
+	}
+
+	go func(idx int) {
+		err := cmd.Wait()
+		if logFile != nil {
+			logFile.Close()
+		}
+
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		job := &b.jobs[idx].job
+		finished := time.Now()
+		job.Finished = &finished
+		if job.Status == StatusCancelled {
+			return
+		} else if err != nil {
+			job.Status = StatusFailed
+		} else {
+			job.Status = StatusOK
+		}
+	}(len(b.jobs) - 1)
+
+	return
+}
+
+func (b *LocalBackend) get(id int) (job *localJob, err error) {
+	if id < 1 || id > len(b.jobs) {
+		err = fmt.Errorf("No job with ID %d", id)
+		return
+	}
+	job = &b.jobs[id-1]
+	return
+}
+
+func (b *LocalBackend) Query(id int) (job Job, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	cur, err := b.get(id)
+	if err != nil {
+		return
+	}
+	job = cur.job
+	return
+}
+
+func (b *LocalBackend) Cancel(id int) (err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	cur, err := b.get(id)
+	if err != nil || cur.job.IsDone() {
+		return
+	}
+
+	cur.job.Status = StatusCancelled
+	if err = cur.cmd.Process.Kill(); errors.Is(err, os.ErrProcessDone) {
+		err = nil
+	}
+	return
+}
+
+func (b *LocalBackend) List() (jobs []Job, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, cur := range b.jobs {
+		jobs = append(jobs, cur.job)
+	}
+	return
+}
+
+func (b *LocalBackend) Log(id int) (log []byte, err error) {
+	b.mutex.Lock()
+	cur, err := b.get(id)
+	var path string
+	if err == nil {
+		path = cur.log
+	}
+	b.mutex.Unlock()
+	if err != nil {
+		return
+	}
+
+	if len(path) == 0 {
+		err = fmt.Errorf("No build log of job %d was kept", id)
+		return
+	}
+	return os.ReadFile(path)
+}
+
+// FinishTier adds the artefacts of the packages built successfully in the
+// tier to the local repository and reindexes it.
+func (b *LocalBackend) FinishTier(results []Result) (err error) {
+	if len(b.cfg.Repo) == 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	var built []localJob
+	for _, res := range results {
+		if !res.OK() || res.Skipped {
+			continue
+		}
+		if cur, err := b.get(res.Job.ID); err == nil {
+			built = append(built, *cur)
+		}
+	}
+	b.mutex.Unlock()
+
+	if len(built) == 0 {
+		return
+	}
+
+	if err = os.MkdirAll(b.cfg.Repo, 0o755); err != nil {
+		return fmt.Errorf("Failed to create local repository %s: %w", b.cfg.Repo, err)
+	}
+
+	for _, cur := range built {
+		var artefacts []string
+		if artefacts, err = b.artefacts(cur); err != nil {
+			return
+		}
+		if len(artefacts) == 0 {
+			waterlog.Warnf("No artefacts of %s found in %s\n", cur.pkg.Source, cur.pkg.Path)
+		}
+
+		for _, artefact := range artefacts {
+			waterlog.Debugf("LocalBackend: adding %s to %s\n", artefact, b.cfg.Repo)
+			if err = copyFile(artefact, filepath.Join(b.cfg.Repo, filepath.Base(artefact))); err != nil {
+				return fmt.Errorf("Failed to add %s to local repository: %w", artefact, err)
+			}
+		}
+	}
+
+	cmd := exec.Command(b.cfg.IndexCommand[0], b.cfg.IndexCommand[1:]...)
+	cmd.Dir = b.cfg.Repo
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to index local repository %s with %q: %w, output: %s", b.cfg.Repo, b.cfg.IndexCommand, err, string(output))
+	}
+	return
+}
+
+// artefacts returns the files in the recipe directory of `cur` that match the
+// artefact globs and were written by its build.
+func (b *LocalBackend) artefacts(cur localJob) (res []string, err error) {
+	for _, glob := range b.cfg.Artefacts {
+		var matches []string
+		if matches, err = filepath.Glob(filepath.Join(cur.pkg.Path, glob)); err != nil {
+			err = fmt.Errorf("Invalid artefact glob %s: %w", glob, err)
+			return
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || info.ModTime().Before(cur.started) {
+				continue
+			}
+			res = append(res, match)
+		}
+	}
+
+	slices.Sort(res)
+	return
+}
+
+func copyFile(from string, to string) (err error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return
+	}
+
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return
+	}
+	return dst.Close()
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LogFetcher is implemented by the backends that can return the build log of
+// a job.
+type LogFetcher interface {
+	Log(id int) ([]byte, error)
+}
+
+// LogName returns the file name that the build log of job `id` of `source`
+// is saved as.
+func LogName(source string, id int) string {
+	return fmt.Sprintf("%s-%d.log", source, id)
+}
+
+// Problem is a line of a build log that likely explains why the build failed.
+type Problem struct {
+	// Kind is one of `pkgconfig`, `compiler`, `test` and `build`.
+	Kind string
+	Line string
+}
+
+// problemPatterns are tried in order, so the more specific ones come first.
+var problemPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"pkgconfig", regexp.MustCompile(`No package '[^']+' found`)},
+	{"pkgconfig", regexp.MustCompile(`Package '[^']+'.* not found`)},
+	{"pkgconfig", regexp.MustCompile(`Dependency "?[^" ]+"? (found: NO|not found)`)},
+	{"pkgconfig", regexp.MustCompile(`None of the required '[^']+' found`)},
+	{"pkgconfig", regexp.MustCompile(`Could not find a package configuration file provided by`)},
+	{"compiler", regexp.MustCompile(`:\d+(:\d+)?: (fatal )?error:`)},
+	{"compiler", regexp.MustCompile(`^error(\[E\d+\])?: `)},
+	{"compiler", regexp.MustCompile(`undefined reference to`)},
+	{"compiler", regexp.MustCompile(`ld(\.\w+)?: cannot find`)},
+	{"test", regexp.MustCompile(`^(--- )?FAIL\b`)},
+	{"test", regexp.MustCompile(`(?i)\btests? (suite )?failed\b`)},
+	{"test", regexp.MustCompile(`(?i)^\s*\d+ (tests? )?failed\b`)},
+	{"test", regexp.MustCompile(`^# FAIL:\s+[1-9]`)},
+	{"test", regexp.MustCompile(`\*\*\* \[[^]]*(check|test)[^]]*\]`)},
+	{"build", regexp.MustCompile(`\*\*\* \[.*\] Error \d+`)},
+	{"build", regexp.MustCompile(`ninja: build stopped`)},
+	{"build", regexp.MustCompile(`(?i)^error: `)},
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// Summarize returns the last `limit` lines of `log` that look like why the
+// build failed, such as compiler errors, missing pkgconfig dependencies and
+// test failures, in the order they appear.
+func Summarize(log []byte, limit int) (problems []Problem) {
+	scanner := bufio.NewScanner(bytes.NewReader(log))
+	scanner.Buffer(nil, 1024*1024)
+	seen := make(map[Problem]bool)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(ansiEscape.ReplaceAllString(scanner.Text(), ""))
+		if len(line) == 0 {
+			continue
+		}
+
+		for _, pattern := range problemPatterns {
+			if !pattern.re.MatchString(line) {
+				continue
+			}
+
+			problem := Problem{Kind: pattern.kind, Line: line}
+			if !seen[problem] {
+				seen[problem] = true
+				problems = append(problems, problem)
+			}
+			break
+		}
+	}
+
+	if limit > 0 && len(problems) > limit {
+		problems = problems[len(problems)-limit:]
+	}
+	return
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/yourbasic/graph"
+)
+
+// PlanSources collapses the split nodes in `order`, the build order of
+// packages of `st` from state.QueryOrder, back into one package per source
+// build, see MergeSplits.
+//
+// Every source is planned at the earliest tier after all the sources that any
+// of its split nodes depends on. Sources whose splits depend on each other,
+// which is what splits usually break, cannot all be satisfied. They are
+// ordered by the latest tier of their nodes instead, and a warning is
+// returned for each such group.
+func PlanSources(st state.State, order [][]common.Package) (plan [][]common.Package, warnings []string) {
+	nodes := utils.Flatten(order)
+	groups := GroupBySource(nodes)
+
+	// The tier of each node in `nodes`
+	var tierOf []int
+	for tierIdx, tier := range order {
+		for range tier {
+			tierOf = append(tierOf, tierIdx)
+		}
+	}
+
+	// The source of each chosen node, and the latest tier of each source
+	srcOf := make(map[int]int)
+	latest := make([]int, len(groups))
+	for group, members := range groups {
+		for _, member := range members {
+			latest[group] = max(latest[group], tierOf[member])
+			for _, idx := range state.NodesOf(st, nodes[member]) {
+				srcOf[idx] = group
+			}
+		}
+	}
+
+	// Lift the dependencies between the nodes to their sources
+	lifted := utils.LiftGraph(st.DepGraph(), func(i int) bool {
+		_, ok := srcOf[i]
+		return ok
+	})
+	sources := graph.New(len(groups))
+	for node, src := range srcOf {
+		lifted.Visit(node, func(dependent int, _ int64) (skip bool) {
+			if dependentSrc, ok := srcOf[dependent]; ok && dependentSrc != src {
+				sources.Add(src, dependentSrc)
+			}
+			return
+		})
+	}
+
+	// Order the sources that depend on each other by the latest tier of
+	// their nodes, then by their name. Recipes of the same name in different
+	// directories are ordered by their first appearance.
+	compare := func(a int, b int) int {
+		if c := cmp.Compare(latest[a], latest[b]); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(SourceName(nodes[groups[a][0]]), SourceName(nodes[groups[b][0]])); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	}
+	for _, comp := range graph.StrongComponents(sources) {
+		if len(comp) < 2 {
+			continue
+		}
+
+		slices.SortFunc(comp, compare)
+		names := make([]string, len(comp))
+		for idx, src := range comp {
+			names[idx] = SourceName(nodes[groups[src][0]])
+		}
+		warnings = append(warnings, fmt.Sprintf("%s depend on each other through split nodes, so they cannot all be built after their dependencies; building them in the order %s",
+			strings.Join(names, ", "), strings.Join(names, " < ")))
+
+		for _, a := range comp {
+			for _, b := range comp {
+				if sources.Edge(a, b) && compare(b, a) < 0 {
+					sources.Delete(a, b)
+				}
+			}
+		}
+	}
+
+	tiers, _ := utils.TieredTopSort(sources)
+	for _, tier := range tiers {
+		planned := make([]common.Package, len(tier))
+		for idx, src := range tier {
+			members := make([]common.Package, len(groups[src]))
+			for memberIdx, member := range groups[src] {
+				members[memberIdx] = nodes[member]
+			}
+
+			planned[idx] = members[0]
+			if len(members) > 1 {
+				planned[idx] = MergeSplits(members)
+			}
+		}
+		plan = append(plan, planned)
+	}
+	return
+}
@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/yourbasic/graph"
+)
+
+// testState is a state of `pkgs` where each of `deps` is an edge from a
+// package to one that depends on it.
+type testState struct {
+	pkgs  []common.Package
+	graph *graph.Immutable
+}
+
+func newTestState(pkgs []common.Package, deps [][2]int) *testState {
+	g := graph.New(len(pkgs))
+	for _, dep := range deps {
+		g.Add(dep[0], dep[1])
+	}
+	return &testState{pkgs: pkgs, graph: graph.Sort(g)}
+}
+
+func (s *testState) Packages() []common.Package  { return s.pkgs }
+func (s *testState) PvdToPkgIdx() map[string]int { return map[string]int{} }
+func (s *testState) DepGraph() *graph.Immutable  { return s.graph }
+
+func (s *testState) SrcToPkgIds() map[string][]int {
+	ids := make(map[string][]int)
+	for idx, pkg := range s.pkgs {
+		ids[pkg.Source] = append(ids[pkg.Source], idx)
+	}
+	return ids
+}
+
+// planNames returns the names of the sources in each tier of `plan`.
+func planNames(plan [][]common.Package) (names [][]string) {
+	for _, tier := range plan {
+		var tierNames []string
+		for _, pkg := range tier {
+			tierNames = append(tierNames, pkg.Source)
+		}
+		names = append(names, tierNames)
+	}
+	return
+}
+
+func TestPlanSources(t *testing.T) {
+	glibc := testPackage("glibc")
+	glibcDevel := testPackage("glibc", "glibc-devel")
+	zlib := testPackage("zlib")
+	app := testPackage("app")
+
+	alpha := testPackage("alpha")
+	alphaDevel := testPackage("alpha", "alpha-devel")
+	beta := testPackage("beta")
+	betaDevel := testPackage("beta", "beta-devel")
+
+	tests := []struct {
+		name     string
+		pkgs     []common.Package
+		deps     [][2]int
+		order    [][]int
+		plan     [][]string
+		names    []string
+		warnings int
+	}{
+		{
+			name:  "splits in one tier",
+			pkgs:  []common.Package{glibc, glibcDevel, zlib, app},
+			deps:  [][2]int{{1, 2}, {2, 3}, {0, 3}},
+			order: [][]int{{0, 1}, {2}, {3}},
+			plan:  [][]string{{"glibc"}, {"zlib"}, {"app"}},
+			names: []string{"glibc", "glibc-devel"},
+		},
+		{
+			name:  "splits in different tiers",
+			pkgs:  []common.Package{glibc, glibcDevel, zlib, app},
+			deps:  [][2]int{{0, 1}, {1, 2}, {2, 3}, {0, 3}},
+			order: [][]int{{0}, {1}, {2}, {3}},
+			plan:  [][]string{{"glibc"}, {"zlib"}, {"app"}},
+			names: []string{"glibc", "glibc-devel"},
+		},
+		{
+			// Each source needs a split of the other, both last in the
+			// same tier, so they are ordered by name
+			name:     "splits depending on each other",
+			pkgs:     []common.Package{betaDevel, alpha, beta, alphaDevel},
+			deps:     [][2]int{{1, 2}, {0, 3}},
+			order:    [][]int{{0, 1}, {2, 3}},
+			plan:     [][]string{{"alpha"}, {"beta"}},
+			names:    []string{"alpha", "alpha-devel"},
+			warnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newTestState(tt.pkgs, tt.deps)
+			order := make([][]common.Package, len(tt.order))
+			for tierIdx, tier := range tt.order {
+				for _, idx := range tier {
+					order[tierIdx] = append(order[tierIdx], tt.pkgs[idx])
+				}
+			}
+
+			plan, warnings := PlanSources(st, order)
+			if names := planNames(plan); !slices.EqualFunc(names, tt.plan, slices.Equal[[]string]) {
+				t.Errorf("PlanSources() = %q, want %q", names, tt.plan)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("PlanSources() warned %q, want %d warnings", warnings, tt.warnings)
+			}
+			if len(plan) > 0 && !slices.Equal(plan[0][0].Names, tt.names) {
+				t.Errorf("PlanSources() planned %q first, want the merged %q", plan[0][0].Names, tt.names)
+			}
+		})
+	}
+}
+
+func TestPlanSourcesBuildsOnce(t *testing.T) {
+	pkgs := []common.Package{
+		testPackage("glibc"),
+		testPackage("glibc", "glibc-devel"),
+		testPackage("glibc", "glibc-32bit"),
+		testPackage("zlib"),
+	}
+	st := newTestState(pkgs, [][2]int{{0, 1}, {1, 3}, {0, 2}})
+	order := [][]common.Package{{pkgs[0]}, {pkgs[1], pkgs[2]}, {pkgs[3]}}
+
+	plan, _ := PlanSources(st, order)
+
+	clock := NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	backend := NewFakeBackend()
+	backend.Now = clock.Now
+	publisher := Publisher{
+		Backend: backend,
+		Poller:  &Poller{Backend: backend, Clock: clock, Interval: time.Second},
+	}
+
+	for tierIdx, tier := range plan {
+		results, err := publisher.PublishTier(tier)
+		if err != nil {
+			t.Fatalf("PublishTier() of tier %d failed: %s", tierIdx+1, err)
+		}
+		for _, res := range results {
+			if !res.OK() {
+				t.Errorf("%s failed to build: %v", res.Package.Source, res.Err)
+			}
+		}
+	}
+
+	jobs, err := backend.List()
+	if err != nil {
+		t.Fatalf("List() failed: %s", err)
+	}
+	var tags []string
+	for _, job := range jobs {
+		tags = append(tags, job.Tag)
+	}
+	if want := []string{"glibc-1.0-1", "zlib-1.0-1"}; !slices.Equal(tags, want) {
+		t.Errorf("Built %q, want %q", tags, want)
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/config"
+)
+
+// StatusUnknown is the key of the timeout of statuses that autobuild doesn't
+// know, see Poller.Timeouts.
+const StatusUnknown = "unknown"
+
+// TimeoutError is returned when a job stays in the same status for longer
+// than the timeout of that status.
+type TimeoutError struct {
+	Job   Job
+	After time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("Job %d has been %s for %s", e.Job.ID, e.Job.Status, e.After)
+}
+
+// Poller waits for jobs to finish by querying them with exponential backoff.
+//
+// The interval between queries starts at Interval and doubles every time the
+// status stays the same, up to MaxInterval. It starts over whenever the
+// status changes, including when it moves backwards, e.g. from BUILDING to
+// UNCLAIMED when a builder goes away.
+type Poller struct {
+	Backend Backend
+	Clock   Clock
+
+	Interval    time.Duration
+	MaxInterval time.Duration
+	// Timeouts is how long a job may stay in each status. Statuses without
+	// a timeout may last forever, and statuses that autobuild doesn't know
+	// use the timeout of StatusUnknown.
+	Timeouts map[string]time.Duration
+	// Retries is how many queries in a row may fail before giving up.
+	Retries int
+}
+
+// NewPoller returns a poller of `backend` configured by `cfg`.
+func NewPoller(backend Backend, cfg config.BackendConfig) *Poller {
+	cfg = cfg.WithDefaults()
+	return &Poller{
+		Backend:     backend,
+		Clock:       SystemClock,
+		Interval:    cfg.Interval,
+		MaxInterval: cfg.MaxInterval,
+		Timeouts:    cfg.Timeouts,
+		Retries:     cfg.Retries,
+	}
+}
+
+func (p *Poller) backoff(interval time.Duration) time.Duration {
+	interval *= 2
+	if p.MaxInterval > 0 && interval > p.MaxInterval {
+		interval = p.MaxInterval
+	}
+	return interval
+}
+
+func (p *Poller) timeout(job Job) (timeout time.Duration, ok bool) {
+	status := job.Status
+	if !job.IsKnown() {
+		status = StatusUnknown
+	}
+	timeout, ok = p.Timeouts[status]
+	return
+}
+
+// Wait queries `job` until it's done and returns its final state. `onUpdate`,
+// if not nil, is called whenever the status of the job changes.
+//
+// Failed queries are retried up to Retries times in a row. The error is
+// either the last failed query or a TimeoutError.
+func (p *Poller) Wait(job Job, onUpdate func(job Job)) (Job, error) {
+	interval := p.Interval
+	since := p.Clock.Now()
+	failures := 0
+
+	for !job.IsDone() {
+		p.Clock.Sleep(interval)
+
+		cur, err := p.Backend.Query(job.ID)
+		if err != nil {
+			if failures++; failures > p.Retries {
+				return job, fmt.Errorf("Giving up on job %d after %d failed queries: %w", job.ID, failures, err)
+			}
+			waterlog.Debugf("Poller: query %d of job %d failed, retrying: %s\n", failures, job.ID, err)
+			interval = p.backoff(interval)
+			continue
+		}
+		failures = 0
+		now := p.Clock.Now()
+
+		if cur.Status != job.Status {
+			if cur.IsBehind(job) {
+				waterlog.Debugf("Poller: job %d moved back from %s to %s\n", job.ID, job.Status, cur.Status)
+			} else if !cur.IsKnown() {
+				waterlog.Debugf("Poller: job %d has unknown status %s\n", job.ID, cur.Status)
+			}
+
+			job = cur
+			since = now
+			interval = p.Interval
+			if onUpdate != nil {
+				onUpdate(job)
+			}
+			continue
+		}
+
+		if timeout, ok := p.timeout(job); ok && now.Sub(since) > timeout {
+			return job, TimeoutError{Job: job, After: now.Sub(since)}
+		}
+		interval = p.backoff(interval)
+	}
+	return job, nil
+}
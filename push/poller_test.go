@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testPoller returns a poller of a fake backend whose job of `foo` goes
+// through `script`, see FakeBackend.Script, and that job.
+func testPoller(t *testing.T, script []string, timeouts map[string]time.Duration) (p *Poller, clock *FakeClock, job Job) {
+	t.Helper()
+
+	clock = NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	backend := NewFakeBackend()
+	backend.Now = clock.Now
+	backend.Script = map[string][]string{"foo": script}
+
+	job, err := backend.Submit(testPackage("foo"))
+	if err != nil {
+		t.Fatalf("Submit() failed: %s", err)
+	}
+
+	p = &Poller{
+		Backend:     backend,
+		Clock:       clock,
+		Interval:    10 * time.Second,
+		MaxInterval: 40 * time.Second,
+		Timeouts:    timeouts,
+		Retries:     2,
+	}
+	return
+}
+
+func TestPollerBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []string
+		slept  []time.Duration
+	}{
+		{
+			name:   "doubles up to the maximum",
+			script: []string{StatusUnclaimed, StatusUnclaimed, StatusUnclaimed, StatusUnclaimed, StatusOK},
+			slept:  []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 40 * time.Second, 40 * time.Second},
+		},
+		{
+			name:   "starts over when the status changes",
+			script: []string{StatusUnclaimed, StatusUnclaimed, StatusBuilding, StatusBuilding, StatusOK},
+			slept:  []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 10 * time.Second, 20 * time.Second},
+		},
+		{
+			name:   "done at once",
+			script: []string{StatusFailed},
+			slept:  []time.Duration{10 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, clock, job := testPoller(t, tt.script, nil)
+
+			job, err := p.Wait(job, nil)
+			if err != nil {
+				t.Fatalf("Wait() failed: %s", err)
+			}
+			if want := tt.script[len(tt.script)-1]; job.Status != want {
+				t.Errorf("Wait() returned a job that is %s, want %s", job.Status, want)
+			}
+			if slept := clock.Slept(); !slices.Equal(slept, tt.slept) {
+				t.Errorf("Wait() slept %v, want %v", slept, tt.slept)
+			}
+		})
+	}
+}
+
+func TestPollerTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   []string
+		timeouts map[string]time.Duration
+		status   string
+		after    time.Duration
+	}{
+		{
+			name:     "stuck in the queue",
+			script:   []string{StatusUnclaimed},
+			timeouts: map[string]time.Duration{StatusUnclaimed: 25 * time.Second},
+			status:   StatusUnclaimed,
+			after:    30 * time.Second,
+		},
+		{
+			name:     "stuck building",
+			script:   []string{StatusBuilding},
+			timeouts: map[string]time.Duration{StatusUnclaimed: time.Second, StatusBuilding: 60 * time.Second},
+			status:   StatusBuilding,
+			after:    70 * time.Second,
+		},
+		{
+			name:     "unknown status",
+			script:   []string{"WAITING"},
+			timeouts: map[string]time.Duration{StatusUnknown: 15 * time.Second},
+			status:   "WAITING",
+			after:    30 * time.Second,
+		},
+		{
+			name:     "status without a timeout",
+			script:   []string{StatusBuilding, StatusBuilding, StatusBuilding, StatusBuilding, StatusBuilding, StatusOK},
+			timeouts: map[string]time.Duration{StatusUnclaimed: time.Second},
+			status:   StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, job := testPoller(t, tt.script, tt.timeouts)
+
+			job, err := p.Wait(job, nil)
+			if job.Status != tt.status {
+				t.Errorf("Wait() returned a job that is %s, want %s", job.Status, tt.status)
+			}
+
+			if tt.after == 0 {
+				if err != nil {
+					t.Errorf("Wait() failed: %s", err)
+				}
+				return
+			}
+
+			var timeout TimeoutError
+			if !errors.As(err, &timeout) {
+				t.Fatalf("Wait() returned %v, want a TimeoutError", err)
+			}
+			if timeout.Job.Status != tt.status || timeout.After != tt.after {
+				t.Errorf("Wait() timed out %s after %s, want %s after %s", timeout.Job.Status, timeout.After, tt.status, tt.after)
+			}
+		})
+	}
+}
+
+func TestPollerRetries(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []string
+		fail   bool
+	}{
+		{
+			name:   "recovers",
+			script: []string{"ERROR", "ERROR", StatusBuilding, "ERROR", "ERROR", StatusOK},
+		},
+		{
+			name:   "gives up",
+			script: []string{StatusBuilding, "ERROR", "ERROR", "ERROR", StatusOK},
+			fail:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, clock, job := testPoller(t, tt.script, nil)
+
+			job, err := p.Wait(job, nil)
+			if tt.fail {
+				var timeout TimeoutError
+				if err == nil || errors.As(err, &timeout) {
+					t.Fatalf("Wait() returned %v, want the failed query", err)
+				}
+				if job.Status != StatusBuilding {
+					t.Errorf("Wait() returned a job that is %s, want the last known status %s", job.Status, StatusBuilding)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Wait() failed: %s", err)
+			}
+			if job.Status != StatusOK {
+				t.Errorf("Wait() returned a job that is %s, want %s", job.Status, StatusOK)
+			}
+
+			// Failed queries back off too
+			want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second}
+			if slept := clock.Slept(); !slices.Equal(slept, want) {
+				t.Errorf("Wait() slept %v, want %v", slept, want)
+			}
+		})
+	}
+}
+
+func TestPollerBackwards(t *testing.T) {
+	script := []string{StatusClaimed, StatusBuilding, StatusBuilding, StatusUnclaimed, StatusBuilding, StatusOK}
+	p, clock, job := testPoller(t, script, map[string]time.Duration{StatusBuilding: 25 * time.Second})
+
+	var updates []string
+	job, err := p.Wait(job, func(job Job) {
+		updates = append(updates, job.Status)
+	})
+	if err != nil {
+		t.Fatalf("Wait() failed: %s", err)
+	}
+	if job.Status != StatusOK {
+		t.Errorf("Wait() returned a job that is %s, want %s", job.Status, StatusOK)
+	}
+
+	// Moving back to the queue is an update like any other, and the time
+	// spent building before doesn't count towards the timeout afterwards
+	want := []string{StatusClaimed, StatusBuilding, StatusUnclaimed, StatusBuilding, StatusOK}
+	if !slices.Equal(updates, want) {
+		t.Errorf("Wait() updated %q, want %q", updates, want)
+	}
+	slept := []time.Duration{10 * time.Second, 10 * time.Second, 10 * time.Second, 20 * time.Second, 10 * time.Second, 10 * time.Second}
+	if got := clock.Slept(); !slices.Equal(got, slept) {
+		t.Errorf("Wait() slept %v, want %v", got, slept)
+	}
+}
@@ -0,0 +1,227 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/getsolus/libeopkg/pspec"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// PreflightError lists what is wrong with the recipes before they are
+// published, see Preflight.
+type PreflightError struct {
+	Problems []string
+}
+
+func (e PreflightError) Error() string {
+	return fmt.Sprintf("%d pre-flight checks failed:\n  %s", len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+// Preflight checks that the build server will build the recipes of `pkgs` as
+// they are committed, i.e. that for every one of them:
+//
+//   - the recipe directory has no uncommitted changes, and
+//   - `pspec_x86_64.xml` of ypkg recipes is committed and has the version
+//     and release of `package.yml`.
+//
+// These are checked before the recipes are pushed, see CheckUpstream for
+// what's checked after. The failed checks are returned as a PreflightError.
+func Preflight(pkgs []common.Package) (err error) {
+	return checkRepos(pkgs, preflightRepo)
+}
+
+// CheckUpstream checks that HEAD of the repository of every recipe of `pkgs`
+// is contained in the upstream branch, as of the last fetch or push, so that
+// the build server can see it. The failed checks are returned as a
+// PreflightError.
+func CheckUpstream(pkgs []common.Package) (err error) {
+	return checkRepos(pkgs, func(root string, repo *git.Repository, head *plumbing.Reference, commit *object.Commit, _ []common.Package) (problems []string, err error) {
+		problem, err := checkUpstream(repo, head, commit)
+		if err != nil {
+			err = fmt.Errorf("Failed to check upstream of repository at %s: %w", root, err)
+		} else if len(problem) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s", root, problem))
+		}
+		return
+	})
+}
+
+// repoCheck returns what's wrong with the recipes `pkgs` in the repository at
+// `root`, whose HEAD is `head` pointing to `commit`.
+type repoCheck func(root string, repo *git.Repository, head *plumbing.Reference, commit *object.Commit, pkgs []common.Package) (problems []string, err error)
+
+// checkRepos runs `check` on the repository of every recipe of `pkgs` and
+// collects the problems into a PreflightError.
+func checkRepos(pkgs []common.Package, check repoCheck) (err error) {
+	var problems []string
+
+	roots := make(map[string][]common.Package)
+	for _, pkg := range pkgs {
+		roots[pkg.Root] = append(roots[pkg.Root], pkg)
+	}
+
+	sorted := make([]string, 0, len(roots))
+	for root := range roots {
+		sorted = append(sorted, root)
+	}
+	slices.Sort(sorted)
+
+	for _, root := range sorted {
+		repo, err := git.PlainOpen(root)
+		if err != nil {
+			return fmt.Errorf("Failed to open git repository at %s: %w", root, err)
+		}
+
+		head, err := repo.Head()
+		if err != nil {
+			return fmt.Errorf("Failed to get HEAD of repository at %s: %w", root, err)
+		}
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			return fmt.Errorf("Failed to get HEAD commit of repository at %s: %w", root, err)
+		}
+
+		rootProblems, err := check(root, repo, head, commit, roots[root])
+		if err != nil {
+			return err
+		}
+		problems = append(problems, rootProblems...)
+	}
+
+	if len(problems) > 0 {
+		err = PreflightError{Problems: problems}
+	}
+	return
+}
+
+func preflightRepo(root string, repo *git.Repository, head *plumbing.Reference, commit *object.Commit, pkgs []common.Package) (problems []string, err error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		err = fmt.Errorf("Failed to get worktree of repository at %s: %w", root, err)
+		return
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		err = fmt.Errorf("Failed to get status of repository at %s: %w", root, err)
+		return
+	}
+
+	for _, pkg := range pkgs {
+		var rel string
+		if rel, err = filepath.Rel(root, pkg.Path); err != nil {
+			err = fmt.Errorf("Failed to convert %s to a path relative to %s: %w", pkg.Path, root, err)
+			return
+		}
+		rel = filepath.ToSlash(rel)
+
+		var dirty []string
+		for file, fileStatus := range status {
+			if (rel == "." || strings.HasPrefix(file, rel+"/")) && (fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified) {
+				dirty = append(dirty, file)
+			}
+		}
+		if len(dirty) > 0 {
+			slices.Sort(dirty)
+			problems = append(problems, fmt.Sprintf("%s: uncommitted changes in %s", pkg.Source, strings.Join(dirty, " ")))
+		}
+
+		if utils.PathExists(filepath.Join(pkg.Path, "package.yml")) {
+			if problem := checkPspec(commit, path.Join(rel, "pspec_x86_64.xml"), pkg); len(problem) > 0 {
+				problems = append(problems, fmt.Sprintf("%s: %s", pkg.Source, problem))
+			}
+		}
+	}
+	return
+}
+
+// checkUpstream returns what's wrong if HEAD is not contained in the remote
+// tracking branch of the current branch.
+func checkUpstream(repo *git.Repository, head *plumbing.Reference, commit *object.Commit) (problem string, err error) {
+	if !head.Name().IsBranch() {
+		problem = "HEAD is detached, not on a branch"
+		return
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return
+	}
+
+	branch, ok := cfg.Branches[head.Name().Short()]
+	if !ok || len(branch.Remote) == 0 || len(branch.Merge) == 0 {
+		problem = fmt.Sprintf("branch %s has no upstream branch", head.Name().Short())
+		return
+	}
+
+	upstreamName := plumbing.NewRemoteReferenceName(branch.Remote, branch.Merge.Short())
+	upstream, err := repo.Reference(upstreamName, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		err = nil
+		problem = fmt.Sprintf("upstream branch %s is not found, fetch or push it first", upstreamName.Short())
+		return
+	} else if err != nil {
+		return
+	}
+
+	if upstream.Hash() == head.Hash() {
+		return
+	}
+
+	upstreamCommit, err := repo.CommitObject(upstream.Hash())
+	if err != nil {
+		return
+	}
+	contained, err := commit.IsAncestor(upstreamCommit)
+	if err != nil {
+		return
+	}
+	if !contained {
+		problem = fmt.Sprintf("HEAD %s is not pushed to %s", head.Hash().String()[:8], upstreamName.Short())
+	}
+	return
+}
+
+// checkPspec returns what's wrong if the pspec at `file` is not committed in
+// `commit` or doesn't match the version and release of `pkg`.
+func checkPspec(commit *object.Commit, file string, pkg common.Package) (problem string) {
+	committed, err := commit.File(file)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return fmt.Sprintf("%s is not committed", path.Base(file))
+	} else if err != nil {
+		return fmt.Sprintf("failed to read committed %s: %s", path.Base(file), err)
+	}
+
+	contents, err := committed.Contents()
+	if err != nil {
+		return fmt.Sprintf("failed to read committed %s: %s", path.Base(file), err)
+	}
+
+	var pspecXml pspec.PSpec
+	if err = xml.Unmarshal([]byte(contents), &pspecXml); err != nil {
+		return fmt.Sprintf("failed to parse committed %s: %s", path.Base(file), err)
+	}
+	if len(pspecXml.History) == 0 {
+		return fmt.Sprintf("committed %s has no history", path.Base(file))
+	}
+
+	latest := pspecXml.History[0]
+	if latest.Version != pkg.Version || latest.Release != pkg.Release {
+		return fmt.Sprintf("committed %s is at %s-%d but package.yml is at %s-%d, rebuild it",
+			path.Base(file), latest.Version, latest.Release, pkg.Version, pkg.Release)
+	}
+	return
+}
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GZGavinZhao/autobuild/common"
+)
+
+// Result is the outcome of publishing a package.
+type Result struct {
+	Package common.Package
+	Job     Job
+	// Started is when the job was first seen building, if it ever was.
+	Started time.Time
+	Err     error
+	// Skipped is true if the package was already built in an earlier
+	// attempt, see Publisher.Previous.
+	Skipped bool
+}
+
+// OK returns whether the package was built successfully.
+func (r Result) OK() bool {
+	return r.Err == nil && r.Job.Status == StatusOK
+}
+
+// Publisher publishes the packages of a tier concurrently and waits for them
+// to be built.
+type Publisher struct {
+	Backend Backend
+	// Jobs is the maximum number of packages being published at the same
+	// time. Zero means no limit.
+	Jobs int
+	// Poller waits for the jobs to finish. It must query Backend.
+	Poller *Poller
+	// OnUpdate, if set, is called whenever the status of a package changes.
+	// It's called from multiple goroutines.
+	OnUpdate func(res Result)
+	// Previous, if set, returns the result of an earlier attempt to publish
+	// a package, e.g. from the journal of a resumed session. Packages that
+	// were built successfully are skipped and jobs that are still in flight
+	// are waited for instead of being published again.
+	Previous func(pkg common.Package) (res Result, ok bool)
+}
+
+// PublishTier publishes every package in `tier` and waits for all of them to
+// finish building. The results are in the same order as `tier`.
+//
+// Every package is built on its own, so the split nodes of a source must be
+// merged into one package beforehand, see PlanSources.
+//
+// The error is only about finishing the tier, see TierFinisher. Whether each
+// package is built is reported in its result.
+func (p *Publisher) PublishTier(tier []common.Package) (results []Result, err error) {
+	results = make([]Result, len(tier))
+
+	jobs := p.Jobs
+	if jobs <= 0 || jobs > len(tier) {
+		jobs = len(tier)
+	}
+	sem := make(chan struct{}, jobs)
+
+	var wg sync.WaitGroup
+	for idx, pkg := range tier {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int, pkg common.Package) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[idx] = p.publish(pkg)
+		}(idx, pkg)
+	}
+	wg.Wait()
+
+	if finisher, ok := p.Backend.(TierFinisher); ok {
+		err = finisher.FinishTier(results)
+	}
+	return
+}
+
+func (p *Publisher) update(res Result) {
+	if p.OnUpdate != nil {
+		p.OnUpdate(res)
+	}
+}
+
+func (p *Publisher) publish(pkg common.Package) (res Result) {
+	res.Package = pkg
+	defer func() { p.update(res) }()
+
+	prev, ok := Result{}, false
+	if p.Previous != nil {
+		prev, ok = p.Previous(pkg)
+	}
+
+	if ok && prev.OK() {
+		res = prev
+		res.Skipped = true
+		return
+	} else if ok && prev.Job.ID != 0 && !prev.Job.IsDone() {
+		res = prev
+		res.Err = nil
+	} else if res.Job, res.Err = p.Backend.Submit(pkg); res.Err != nil {
+		return
+	}
+	p.update(res)
+
+	job, err := p.Poller.Wait(res.Job, func(job Job) {
+		switch {
+		case job.Status == StatusBuilding && res.Started.IsZero():
+			res.Started = p.Poller.Clock.Now()
+		case job.Status == StatusUnclaimed || job.Status == StatusClaimed:
+			// Moved back to the queue, the build starts over
+			res.Started = time.Time{}
+		}
+		res.Job = job
+		p.update(res)
+	})
+	res.Job = job
+	if err != nil {
+		res.Err = err
+		return
+	}
+
+	if res.Job.Status != StatusOK {
+		res.Err = fmt.Errorf("Job %d of %s finished with status %s", res.Job.ID, pkg.Source, res.Job.Status)
+	}
+	return
+}
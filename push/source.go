@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
+// SourceName returns the name of the source recipe that builds `pkg`, which
+// is what the build server is asked to build.
+//
+// Every node of a split stone recipe and every subpackage of a ypkg recipe
+// has the name of the recipe as its Source. Nodes without one, e.g. splits
+// that ended up empty, fall back to their first name and then to the
+// directory of the recipe.
+func SourceName(pkg common.Package) string {
+	switch {
+	case len(pkg.Source) > 0:
+		return pkg.Source
+	case len(pkg.Names) > 0:
+		return pkg.Names[0]
+	case len(pkg.Path) > 0:
+		return filepath.Base(pkg.Path)
+	default:
+		return ""
+	}
+}
+
+// BuildTag returns the tag of the build of `pkg`, i.e.
+// `<source>-<version>-<release>`.
+func BuildTag(pkg common.Package) string {
+	return fmt.Sprintf("%s-%s-%d", SourceName(pkg), pkg.Version, pkg.Release)
+}
+
+// SourceKey returns what identifies the source build of `pkg`: its recipe
+// directory if it's known, else its source name. The split nodes of a recipe
+// have the same key.
+func SourceKey(pkg common.Package) string {
+	if len(pkg.Path) > 0 {
+		return pkg.Path
+	}
+	return SourceName(pkg)
+}
+
+// GroupBySource groups the indices of `pkgs` by their source build, in the
+// order that each source first appears.
+func GroupBySource(pkgs []common.Package) (groups [][]int) {
+	keyToGroup := make(map[string]int)
+	for idx, pkg := range pkgs {
+		key := SourceKey(pkg)
+		if group, ok := keyToGroup[key]; ok {
+			groups[group] = append(groups[group], idx)
+			continue
+		}
+		keyToGroup[key] = len(groups)
+		groups = append(groups, []int{idx})
+	}
+	return
+}
+
+// MergeSplits merges the split nodes `nodes` of the same source back into the
+// package that is built for all of them. The first node decides the source,
+// version and release; the names, providers and dependencies of all nodes
+// are combined, in order.
+func MergeSplits(nodes []common.Package) (merged common.Package) {
+	if len(nodes) == 0 {
+		return
+	}
+
+	merged = nodes[0]
+	merged.Source = SourceName(nodes[0])
+	merged.Names = nil
+	merged.Provides = nil
+	merged.BuildDeps = nil
+	merged.LinkDeps = nil
+	merged.SubProvides = make(map[string][]string)
+
+	for _, node := range nodes {
+		for _, name := range node.Names {
+			if !slices.Contains(merged.Names, name) {
+				merged.Names = append(merged.Names, name)
+			}
+		}
+		merged.Provides = append(merged.Provides, node.Provides...)
+		merged.BuildDeps = append(merged.BuildDeps, node.BuildDeps...)
+		merged.LinkDeps = append(merged.LinkDeps, node.LinkDeps...)
+		for name, provides := range node.SubProvides {
+			merged.SubProvides[name] = append(merged.SubProvides[name], provides...)
+		}
+	}
+
+	slices.Sort(merged.Provides)
+	merged.Provides = utils.Uniq2(merged.Provides)
+	slices.Sort(merged.BuildDeps)
+	merged.BuildDeps = utils.Uniq2(merged.BuildDeps)
+	slices.Sort(merged.LinkDeps)
+	merged.LinkDeps = utils.Uniq2(merged.LinkDeps)
+	return
+}
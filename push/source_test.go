@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package push
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/common"
+)
+
+var (
+	// A ypkg recipe is a single node with all of its subpackages
+	ypkgZlib = common.Package{
+		Path:     "/packages/z/zlib",
+		Source:   "zlib",
+		Names:    []string{"zlib", "zlib-devel", "zlib-32bit", "zlib-32bit-devel"},
+		Version:  "1.3",
+		Release:  5,
+		Provides: []string{"pkgconfig(zlib)", "pkgconfig32(zlib)", "soname(libz.so.1(x86_64))"},
+	}
+
+	// A stone recipe is split into a node per group of subpackages
+	stoneGlibc = common.Package{
+		Path:        "/recipes/g/glibc",
+		Source:      "glibc",
+		Names:       []string{"glibc"},
+		Version:     "2.38",
+		Release:     1,
+		Provides:    []string{"soname(libc.so.6(x86_64))"},
+		BuildDeps:   []string{"binary(bison)"},
+		SubProvides: map[string][]string{"glibc": {"soname(libc.so.6(x86_64))"}},
+	}
+	stoneGlibcDevel = common.Package{
+		Path:        "/recipes/g/glibc",
+		Source:      "glibc",
+		Names:       []string{"glibc-devel", "glibc-32bit-devel"},
+		Version:     "2.38",
+		Release:     1,
+		Provides:    []string{"pkgconfig(glibc)", "soname(libc.so.6(x86_64))"},
+		BuildDeps:   []string{"binary(bison)", "binary(python3)"},
+		SubProvides: map[string][]string{"glibc-devel": {"pkgconfig(glibc)"}, "glibc-32bit-devel": nil},
+	}
+)
+
+func TestSourceName(t *testing.T) {
+	tests := []struct {
+		name string
+		pkg  common.Package
+		want string
+	}{
+		{"ypkg with subpackages", ypkgZlib, "zlib"},
+		{"stone main split", stoneGlibc, "glibc"},
+		{"stone devel split", stoneGlibcDevel, "glibc"},
+		{"no source", common.Package{Path: "/recipes/f/foo", Names: []string{"foo-docs"}}, "foo-docs"},
+		{"only a path", common.Package{Path: "/recipes/f/foo"}, "foo"},
+		{"nothing", common.Package{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SourceName(tt.pkg); got != tt.want {
+				t.Errorf("SourceName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTag(t *testing.T) {
+	tests := []struct {
+		name string
+		pkg  common.Package
+		want string
+	}{
+		{"ypkg with subpackages", ypkgZlib, "zlib-1.3-5"},
+		{"stone main split", stoneGlibc, "glibc-2.38-1"},
+		{"stone devel split", stoneGlibcDevel, "glibc-2.38-1"},
+		{"merged stone splits", MergeSplits([]common.Package{stoneGlibcDevel, stoneGlibc}), "glibc-2.38-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildTag(tt.pkg); got != tt.want {
+				t.Errorf("BuildTag() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupBySource(t *testing.T) {
+	// Another recipe of the same name elsewhere is a different source
+	forked := stoneGlibc
+	forked.Path = "/fork/glibc"
+
+	tests := []struct {
+		name string
+		pkgs []common.Package
+		want [][]int
+	}{
+		{"ypkg", []common.Package{ypkgZlib}, [][]int{{0}}},
+		{"stone splits", []common.Package{stoneGlibc, stoneGlibcDevel}, [][]int{{0, 1}}},
+		{"mixed", []common.Package{stoneGlibcDevel, ypkgZlib, stoneGlibc}, [][]int{{0, 2}, {1}}},
+		{"same name in another directory", []common.Package{stoneGlibc, forked, stoneGlibcDevel}, [][]int{{0, 2}, {1}}},
+		{"no paths", []common.Package{{Source: "foo"}, {Source: "bar"}, {Source: "foo"}}, [][]int{{0, 2}, {1}}},
+		{"empty", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := GroupBySource(tt.pkgs)
+			if !slices.EqualFunc(groups, tt.want, slices.Equal[[]int]) {
+				t.Errorf("GroupBySource() = %v, want %v", groups, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSplits(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []common.Package
+		want  common.Package
+	}{
+		{
+			name:  "ypkg",
+			nodes: []common.Package{ypkgZlib},
+			want: common.Package{
+				Source:      "zlib",
+				Names:       ypkgZlib.Names,
+				Provides:    ypkgZlib.Provides,
+				SubProvides: map[string][]string{},
+			},
+		},
+		{
+			name:  "stone splits",
+			nodes: []common.Package{stoneGlibc, stoneGlibcDevel},
+			want: common.Package{
+				Source:    "glibc",
+				Names:     []string{"glibc", "glibc-devel", "glibc-32bit-devel"},
+				Provides:  []string{"pkgconfig(glibc)", "soname(libc.so.6(x86_64))"},
+				BuildDeps: []string{"binary(bison)", "binary(python3)"},
+				SubProvides: map[string][]string{
+					"glibc":             {"soname(libc.so.6(x86_64))"},
+					"glibc-devel":       {"pkgconfig(glibc)"},
+					"glibc-32bit-devel": nil,
+				},
+			},
+		},
+		{
+			name:  "stone split without a source",
+			nodes: []common.Package{{Path: "/recipes/f/foo", Names: []string{"foo-docs"}}, {Path: "/recipes/f/foo", Names: []string{"foo"}}},
+			want: common.Package{
+				Source:      "foo-docs",
+				Names:       []string{"foo-docs", "foo"},
+				SubProvides: map[string][]string{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := MergeSplits(tt.nodes)
+
+			if merged.Source != tt.want.Source || merged.Path != tt.nodes[0].Path {
+				t.Errorf("MergeSplits() is %s in %s, want %s in %s", merged.Source, merged.Path, tt.want.Source, tt.nodes[0].Path)
+			}
+			if merged.Version != tt.nodes[0].Version || merged.Release != tt.nodes[0].Release {
+				t.Errorf("MergeSplits() is at %s-%d, want %s-%d", merged.Version, merged.Release, tt.nodes[0].Version, tt.nodes[0].Release)
+			}
+			if !slices.Equal(merged.Names, tt.want.Names) {
+				t.Errorf("MergeSplits() has names %q, want %q", merged.Names, tt.want.Names)
+			}
+			if !slices.Equal(merged.Provides, tt.want.Provides) {
+				t.Errorf("MergeSplits() provides %q, want %q", merged.Provides, tt.want.Provides)
+			}
+			if !slices.Equal(merged.BuildDeps, tt.want.BuildDeps) {
+				t.Errorf("MergeSplits() build depends on %q, want %q", merged.BuildDeps, tt.want.BuildDeps)
+			}
+			if !maps.EqualFunc(merged.SubProvides, tt.want.SubProvides, slices.Equal[[]string]) {
+				t.Errorf("MergeSplits() has subpackage providers %v, want %v", merged.SubProvides, tt.want.SubProvides)
+			}
+		})
+	}
+
+	if merged := MergeSplits(nil); len(merged.Names) > 0 || len(merged.Source) > 0 {
+		t.Errorf("MergeSplits(nil) = %v, want an empty package", merged)
+	}
+}
@@ -5,13 +5,11 @@
 package state
 
 import (
-	"encoding/xml"
 	"fmt"
-	"net/http"
+	"os"
 
+	"github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/common"
-	"github.com/getsolus/libeopkg/index"
-	"github.com/ulikunitz/xz"
 	"github.com/yourbasic/graph"
 )
 
@@ -21,6 +19,9 @@ type BinaryState struct {
 	srcToPkgIds map[string][]int
 	depGraph    *graph.Immutable
 	isGit       bool
+	// index is whether the packages come from a binary index, which doesn't
+	// list the files of packages, see SonamesKnown.
+	index bool
 }
 
 func (s *BinaryState) Packages() []common.Package {
@@ -43,69 +44,65 @@ func (s *BinaryState) BuildGraph() {
 	panic("Not Implmeneted!")
 }
 
-func LoadEopkgIndex(i *index.Index) (state *BinaryState, err error) {
-	// panic("Not Implmeneted!")
-
+// newBinaryState builds a BinaryState from binary packages, each of which
+// must have exactly one name.
+func newBinaryState(pkgs []common.Package) (state *BinaryState, err error) {
 	state = &BinaryState{}
-	state.packages = make([]common.Package, len(i.Packages))
+	state.packages = pkgs
 	state.pvdToPkgIdx = make(map[string]int)
 	state.srcToPkgIds = make(map[string][]int)
 
-	// Iterate through the eopkg index and check if there are version/release
-	// discrepancies between the source repository and the binary index.
-	for idx, ipkg := range i.Packages {
-		pvd := fmt.Sprintf("name(%s)", ipkg.Name)
+	for idx, pkg := range pkgs {
+		pvd := fmt.Sprintf("name(%s)", pkg.Names[0])
 		if ext, ok := state.pvdToPkgIdx[pvd]; ok {
-			err = fmt.Errorf("Duplicate provider %s, %s provides but already provided by %s", pvd, ipkg.Name, state.packages[ext].Show(true, false))
-			return
-		}
-
-		var pkg common.Package
-		pkg, err = common.ParseIndexPackage(ipkg)
-		if err != nil {
+			err = fmt.Errorf("Duplicate provider %s, %s provides but already provided by %s", pvd, pkg.Names[0], state.packages[ext].Show(true, false))
 			return
 		}
 
 		state.pvdToPkgIdx[pvd] = idx
-		state.srcToPkgIds[ipkg.Source.Name] = append(state.srcToPkgIds[ipkg.Source.Name], idx)
-		state.packages[idx] = pkg
+		state.srcToPkgIds[pkg.Source] = append(state.srcToPkgIds[pkg.Source], idx)
 	}
 
-	return
-}
-
-func LoadBinary(path string) (state *BinaryState, err error) {
-	eopkgIndex, err := index.Load(path)
-	if err != nil {
-		return
+	// Providers other than `name(...)` are only known when the file lists are
+	// available, e.g. for a directory of `.eopkg` files.
+	for idx, pkg := range pkgs {
+		for _, pvd := range pkg.Provides {
+			if pidx, ok := state.pvdToPkgIdx[pvd]; ok {
+				if pidx != idx {
+					waterlog.Debugf("Duplicate provider for %s from %s, currently %s\n", pvd, pkg.Show(true, false), state.packages[pidx].Show(true, false))
+				}
+				continue
+			}
+			state.pvdToPkgIdx[pvd] = idx
+		}
 	}
 
-	state, err = LoadEopkgIndex(eopkgIndex)
 	return
 }
 
-func LoadEopkgRepo(name string) (state *BinaryState, err error) {
-	indexUrl := fmt.Sprintf("https://packages.getsol.us/%s/eopkg-index.xml.xz", name)
-	resp, err := http.Get(indexUrl)
-	if err != nil {
-		err = fmt.Errorf("Failed to fetch binary index from url %s: %w", indexUrl, err)
-		return
+// newIndexState builds a BinaryState from the packages of a binary index.
+func newIndexState(pkgs []common.Package) (state *BinaryState, err error) {
+	if state, err = newBinaryState(pkgs); err == nil {
+		state.index = true
 	}
+	return
+}
 
-	r, err := xz.NewReader(resp.Body)
+// LoadBinary loads an eopkg index file, which may be compressed with xz,
+// zstd or gzip.
+func LoadBinary(path string) (state *BinaryState, err error) {
+	file, err := os.Open(path)
 	if err != nil {
-		err = fmt.Errorf("Failed to create XZ reader with binary index from url %s: %w", indexUrl, err)
 		return
 	}
+	defer file.Close()
 
-	dec := xml.NewDecoder(r)
-	var i index.Index
-	err = dec.Decode(&i)
+	pkgs, err := decodeEopkgIndex(file, "auto")
 	if err != nil {
-		err = fmt.Errorf("Failed to decode binary index from url %s: %w", indexUrl, err)
+		err = fmt.Errorf("Failed to load binary index %s: %w", path, err)
 		return
 	}
 
-	state, err = LoadEopkgIndex(&i)
+	state, err = newIndexState(pkgs)
 	return
 }
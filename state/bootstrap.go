@@ -0,0 +1,260 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/yourbasic/graph"
+)
+
+// BootstrapStep is a single build in a bootstrap plan.
+type BootstrapStep struct {
+	Package common.Package
+	// Stage is 1 for a stage1 build, where the deferred build dependencies
+	// are left out, 2 for the rebuild of a stage1 package once its cycle is
+	// closed, and 0 for packages that are only built once.
+	Stage int
+}
+
+func (s BootstrapStep) Show(sub bool, color bool) string {
+	if s.Stage == 0 {
+		return s.Package.Show(sub, color)
+	}
+	return fmt.Sprintf("%s (stage%d)", s.Package.Show(sub, color), s.Stage)
+}
+
+type bootstrapper struct {
+	state      State
+	deferKinds []string
+	stage1     map[int][]*regexp.Regexp
+}
+
+// BootstrapOrder computes a plan for building the chosen packages from
+// scratch. Unlike QueryOrder, it doesn't fail on cycles as long as they can be
+// broken: a package in a cycle can be built in stage1 without the build
+// dependencies that it's configured to defer (see config.SolverConfig.Stage1)
+// or that are of one of `deferKinds` (e.g. `pkgconfig32`), and then rebuilt
+// once the rest of the cycle is built.
+//
+// Packages that were built against a stage1 build are not rebuilt.
+//
+// The caller is responsible for choosing all the dependencies of the packages
+// it's interested in, there is nothing to build them against otherwise.
+func BootstrapOrder(state State, choose func(int) bool, deferKinds []string) (steps []BootstrapStep, err error) {
+	depGraph := state.DepGraph()
+	if depGraph == nil {
+		err = fmt.Errorf("Adjacency map for dependency graph is nil")
+		return
+	}
+
+	b := bootstrapper{state: state, deferKinds: deferKinds, stage1: make(map[int][]*regexp.Regexp)}
+	pkgs := state.Packages()
+
+	sub := graph.New(depGraph.Order())
+	for node := 0; node < depGraph.Order(); node++ {
+		if !choose(node) {
+			continue
+		}
+
+		for _, re := range pkgs[node].Stage1 {
+			var compiled *regexp.Regexp
+			if compiled, err = regexp.Compile("^(?:" + re + ")$"); err != nil {
+				err = fmt.Errorf("Invalid stage1 regex %q of %s: %w", re, pkgs[node].Show(true, false), err)
+				return
+			}
+			b.stage1[node] = append(b.stage1[node], compiled)
+		}
+
+		depGraph.Visit(node, func(adj int, _ int64) (skip bool) {
+			if choose(adj) {
+				sub.Add(node, adj)
+			}
+			return
+		})
+	}
+
+	// Build the condensation of the graph, i.e. the DAG of its strongly
+	// connected components, and build the components in topological order.
+	comps := graph.StrongComponents(sub)
+	comps = utils.Filter(comps, func(comp []int) bool { return choose(comp[0]) })
+	compOf := make(map[int]int)
+	for compIdx, comp := range comps {
+		slices.Sort(comp)
+		for _, node := range comp {
+			compOf[node] = compIdx
+		}
+	}
+
+	condensed := graph.New(len(comps))
+	for compIdx, comp := range comps {
+		for _, node := range comp {
+			sub.Visit(node, func(adj int, _ int64) (skip bool) {
+				if compOf[adj] != compIdx {
+					condensed.Add(compIdx, compOf[adj])
+				}
+				return
+			})
+		}
+	}
+
+	order, ok := utils.TieredTopSort(condensed)
+	if !ok {
+		err = fmt.Errorf("Condensation of the dependency graph has cycles?!?")
+		return
+	}
+
+	for _, tier := range order {
+		slices.SortFunc(tier, func(a, b int) int {
+			return cmp.Compare(comps[a][0], comps[b][0])
+		})
+
+		for _, compIdx := range tier {
+			comp := comps[compIdx]
+			if len(comp) == 1 {
+				steps = append(steps, BootstrapStep{Package: pkgs[comp[0]]})
+				continue
+			}
+
+			var compSteps []BootstrapStep
+			if compSteps, err = b.breakCycle(sub, comp); err != nil {
+				return
+			}
+			steps = append(steps, compSteps...)
+		}
+	}
+
+	return
+}
+
+// canDefer returns whether `node` can be built without all of its build
+// dependencies that `dep` provides.
+func (b *bootstrapper) canDefer(dep int, node int) bool {
+	pkgs := b.state.Packages()
+	depPkg, pkg := pkgs[dep], pkgs[node]
+
+	found := false
+	for _, pvd := range pkg.BuildDeps {
+		if idx, ok := LookupProvider(b.state, pvd); !ok || idx != dep {
+			continue
+		}
+		found = true
+
+		if slices.Contains(b.deferKinds, common.ParseProvider(pvd).Kind) {
+			continue
+		}
+
+		// The regexes may leave out the architecture of the provider
+		bare := common.ParseProvider(pvd)
+		bare.Arch = ""
+
+		deferred := false
+		for _, re := range b.stage1[node] {
+			if re.MatchString(pvd) || re.MatchString(bare.String()) || re.MatchString(depPkg.Source) || slices.ContainsFunc(depPkg.Names, re.MatchString) {
+				deferred = true
+				break
+			}
+		}
+		if !deferred {
+			return false
+		}
+	}
+
+	return found
+}
+
+// breakCycle orders the strongly connected component `comp` of `g` by
+// greedily picking stage1 packages until the rest of it is acyclic.
+func (b *bootstrapper) breakCycle(g *graph.Mutable, comp []int) (steps []BootstrapStep, err error) {
+	pkgs := b.state.Packages()
+	localOf := make(map[int]int)
+	for local, node := range comp {
+		localOf[node] = local
+	}
+
+	// Packages that are configured to be built in stage1 are preferred
+	candidates := slices.Clone(comp)
+	slices.SortStableFunc(candidates, func(x, y int) int {
+		return cmp.Compare(len(b.stage1[y]), len(b.stage1[x]))
+	})
+
+	stage1 := make(map[int]bool)
+	var reduced *graph.Mutable
+	for {
+		reduced = graph.New(len(comp))
+		for _, node := range comp {
+			g.Visit(node, func(adj int, _ int64) (skip bool) {
+				if local, ok := localOf[adj]; ok && !(stage1[adj] && b.canDefer(node, adj)) {
+					reduced.Add(localOf[node], local)
+				}
+				return
+			})
+		}
+
+		cycles := utils.Filter(graph.StrongComponents(reduced), func(cycle []int) bool { return len(cycle) > 1 })
+		if len(cycles) == 0 {
+			break
+		}
+
+		inCycle := make(map[int]int)
+		for cycleIdx, cycle := range cycles {
+			for _, local := range cycle {
+				inCycle[comp[local]] = cycleIdx + 1
+			}
+		}
+
+		picked := slices.IndexFunc(candidates, func(node int) bool {
+			if stage1[node] || inCycle[node] == 0 {
+				return false
+			}
+
+			deferrable := false
+			for _, other := range comp {
+				if inCycle[other] == inCycle[node] && g.Edge(other, node) && b.canDefer(other, node) {
+					deferrable = true
+					break
+				}
+			}
+			return deferrable
+		})
+
+		if picked == -1 {
+			cyclesErr := QueryHasCyclesErr{}
+			for _, cycle := range cycles {
+				thisCycle := Cycle{}
+				for _, local := range cycle {
+					thisCycle.Members = append(thisCycle.Members, pkgs[comp[local]])
+				}
+				for _, local := range utils.LongerShortestPath(reduced, cycle[0], cycle[1]) {
+					thisCycle.Chain = append(thisCycle.Chain, pkgs[comp[local]])
+				}
+				cyclesErr.Cycles = append(cyclesErr.Cycles, thisCycle)
+			}
+			err = cyclesErr
+			return
+		}
+		stage1[candidates[picked]] = true
+	}
+
+	order, _ := utils.TieredTopSort(reduced)
+	var rebuilds []BootstrapStep
+	for _, local := range utils.Flatten(order) {
+		node := comp[local]
+		if stage1[node] {
+			steps = append(steps, BootstrapStep{Package: pkgs[node], Stage: 1})
+			rebuilds = append(rebuilds, BootstrapStep{Package: pkgs[node], Stage: 2})
+		} else {
+			steps = append(steps, BootstrapStep{Package: pkgs[node]})
+		}
+	}
+	steps = append(steps, rebuilds...)
+
+	return
+}
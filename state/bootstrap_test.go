@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/common"
+)
+
+// bootstrapPackage returns the package `source` that provides `name(source)`
+// and `provides`, and build depends on `deps`.
+func bootstrapPackage(source string, deps []string, provides ...string) common.Package {
+	return common.Package{
+		Source:    source,
+		Names:     []string{source},
+		Version:   "1.0",
+		Release:   1,
+		Provides:  append([]string{"name(" + source + ")"}, provides...),
+		BuildDeps: deps,
+	}
+}
+
+// withStage1 returns `pkg` configured to leave out the build dependencies
+// matching `stage1` in a stage1 build.
+func withStage1(pkg common.Package, stage1 ...string) common.Package {
+	pkg.Stage1 = stage1
+	return pkg
+}
+
+func TestBootstrapOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		pkgs       []common.Package
+		deferKinds []string
+		want       []string
+		cycles     int
+	}{
+		{
+			name: "no cycles",
+			pkgs: []common.Package{
+				bootstrapPackage("app", []string{"name(zlib)"}),
+				bootstrapPackage("zlib", nil),
+			},
+			want: []string{"zlib", "app"},
+		},
+		{
+			name: "two-node cycle",
+			pkgs: []common.Package{
+				bootstrapPackage("alpha", []string{"name(beta)"}),
+				withStage1(bootstrapPackage("beta", []string{"name(alpha)"}), "alpha"),
+			},
+			want: []string{"beta (stage1)", "alpha", "beta (stage2)"},
+		},
+		{
+			name: "cycle between other packages",
+			pkgs: []common.Package{
+				bootstrapPackage("alpha", []string{"name(beta)", "name(base)"}),
+				withStage1(bootstrapPackage("beta", []string{"name(alpha)"}), `name\(alpha\)`),
+				bootstrapPackage("app", []string{"name(alpha)"}),
+				bootstrapPackage("base", nil),
+			},
+			want: []string{"base", "beta (stage1)", "alpha", "beta (stage2)", "app"},
+		},
+		{
+			name: "cycle broken by a deferred kind",
+			pkgs: []common.Package{
+				bootstrapPackage("alpha", []string{"pkgconfig32(beta)"}),
+				bootstrapPackage("beta", []string{"name(alpha)"}, "pkgconfig32(beta)"),
+			},
+			deferKinds: []string{"pkgconfig32"},
+			want:       []string{"alpha (stage1)", "beta", "alpha (stage2)"},
+		},
+		{
+			name: "cycle not broken by a deferred kind",
+			pkgs: []common.Package{
+				bootstrapPackage("alpha", []string{"pkgconfig32(beta)"}),
+				bootstrapPackage("beta", []string{"name(alpha)"}, "pkgconfig32(beta)"),
+			},
+			deferKinds: []string{"pkgconfig"},
+			cycles:     1,
+		},
+		{
+			name: "configured stage1 is preferred",
+			pkgs: []common.Package{
+				bootstrapPackage("alpha", []string{"pkgconfig32(beta)"}, "pkgconfig32(alpha)"),
+				withStage1(bootstrapPackage("beta", []string{"pkgconfig32(alpha)"}, "pkgconfig32(beta)"), "alpha"),
+			},
+			deferKinds: []string{"pkgconfig32"},
+			want:       []string{"beta (stage1)", "alpha", "beta (stage2)"},
+		},
+		{
+			name: "deferring only some build dependencies",
+			pkgs: []common.Package{
+				bootstrapPackage("alpha", []string{"name(beta)", "pkgconfig32(beta)"}),
+				bootstrapPackage("beta", []string{"name(alpha)"}, "pkgconfig32(beta)"),
+			},
+			deferKinds: []string{"pkgconfig32"},
+			cycles:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newSourceState(tt.pkgs, nil)
+			steps, err := BootstrapOrder(state, func(int) bool { return true }, tt.deferKinds)
+
+			if tt.cycles > 0 {
+				var cyclesErr QueryHasCyclesErr
+				if !errors.As(err, &cyclesErr) {
+					t.Fatalf("BootstrapOrder() returned %v, want cycles", err)
+				}
+				if len(cyclesErr.Cycles) != tt.cycles {
+					t.Errorf("BootstrapOrder() found %d cycles, want %d", len(cyclesErr.Cycles), tt.cycles)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BootstrapOrder() failed: %s", err)
+			}
+
+			var got []string
+			for _, step := range steps {
+				got = append(got, step.Show(false, false))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("BootstrapOrder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBootstrapOrderChosen(t *testing.T) {
+	pkgs := []common.Package{
+		bootstrapPackage("alpha", []string{"name(beta)"}),
+		withStage1(bootstrapPackage("beta", []string{"name(alpha)"}), "alpha"),
+		bootstrapPackage("unrelated", nil),
+	}
+	state := newSourceState(pkgs, nil)
+	unrelated := state.SrcToPkgIds()["unrelated"][0]
+
+	steps, err := BootstrapOrder(state, func(node int) bool { return node != unrelated }, nil)
+	if err != nil {
+		t.Fatalf("BootstrapOrder() failed: %s", err)
+	}
+
+	var got []string
+	for _, step := range steps {
+		got = append(got, step.Show(false, false))
+	}
+	if want := []string{"beta (stage1)", "alpha", "beta (stage2)"}; !slices.Equal(got, want) {
+		t.Errorf("BootstrapOrder() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,306 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"cmp"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/progress"
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
+const (
+	cacheIndexFile = "index"
+	cacheMetaFile  = "meta.json"
+)
+
+var (
+	// Offline makes FetchRemote use the cached index of a remote without
+	// revalidating it, and fail if there is none.
+	Offline bool
+
+	ErrNotCached = errors.New("no cached index")
+)
+
+// CachedRemote is the metadata of a cached remote index.
+type CachedRemote struct {
+	Name         string    `json:"name"`
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Checksum     string    `json:"checksum,omitempty"`
+	Sum          string    `json:"sum,omitempty"`
+	Size         int64     `json:"size"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// CacheDir returns the directory that fetched indexes are cached in, i.e.
+// `$XDG_CACHE_HOME/autobuild/repos`.
+func CacheDir() (dir string, err error) {
+	if dir, err = os.UserCacheDir(); err != nil {
+		err = fmt.Errorf("Failed to determine cache directory: %w", err)
+		return
+	}
+	dir = filepath.Join(dir, "autobuild", "repos")
+	return
+}
+
+// cacheEntry returns the directory that the index of the remote `name` is
+// cached in. Names that aren't a single path element are rejected, so that
+// the directory is always inside CacheDir.
+func cacheEntry(name string) (dir string, err error) {
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		err = fmt.Errorf("Invalid remote name %q", name)
+		return
+	}
+
+	if dir, err = CacheDir(); err != nil {
+		return
+	}
+	dir = filepath.Join(dir, name)
+	return
+}
+
+func cachePaths(name string) (dir string, index string, meta string, err error) {
+	if dir, err = cacheEntry(name); err != nil {
+		return
+	}
+	index = filepath.Join(dir, cacheIndexFile)
+	meta = filepath.Join(dir, cacheMetaFile)
+	return
+}
+
+func readCacheMeta(path string) (cached CachedRemote, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(raw, &cached)
+	return
+}
+
+// ListCached returns the metadata of every cached remote index, sorted by name.
+func ListCached() (res []CachedRemote, err error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		cached, err := readCacheMeta(filepath.Join(dir, entry.Name(), cacheMetaFile))
+		if err != nil {
+			waterlog.Warnf("Ignoring broken cache entry %s: %s\n", entry.Name(), err)
+			continue
+		}
+		res = append(res, cached)
+	}
+
+	slices.SortFunc(res, func(a, b CachedRemote) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return
+}
+
+// CleanCache removes the cached indexes of the given remotes, or all of them
+// if none are given.
+func CleanCache(names ...string) (err error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return
+	}
+
+	if len(names) == 0 {
+		return os.RemoveAll(dir)
+	}
+
+	entries := make([]string, len(names))
+	for idx, name := range names {
+		if entries[idx], err = cacheEntry(name); err != nil {
+			return
+		}
+	}
+
+	for _, entry := range entries {
+		if err = os.RemoveAll(entry); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// FetchRemote makes sure that the index of the remote `name` is cached and up
+// to date, then returns the path to the cached (still compressed) index.
+//
+// A cached index is revalidated with its ETag and Last-Modified. When the
+// remote can't be reached or doesn't serve the index or its checksum, the
+// cached index is used with a warning. With Offline, the cached index is used without contacting
+// the remote at all.
+func FetchRemote(name string) (path string, err error) {
+	remote := remoteFor(name)
+	indexUrl := remoteIndexUrl(remote)
+
+	// Local repositories don't need caching.
+	if u, perr := url.Parse(indexUrl); perr == nil && u.Scheme == "file" {
+		path = u.Path
+		return
+	}
+
+	dir, path, metaPath, err := cachePaths(name)
+	if err != nil {
+		return
+	}
+
+	cached, cacheErr := readCacheMeta(metaPath)
+	hasCache := cacheErr == nil && cached.URL == indexUrl && utils.PathExists(path)
+
+	if Offline {
+		if !hasCache {
+			err = fmt.Errorf("%w for %s, fetch it once without --offline first", ErrNotCached, name)
+		}
+		return
+	}
+
+	h, err := newChecksumHash(remote.Checksum)
+	if err != nil {
+		err = fmt.Errorf("Invalid remote %s: %w", name, err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, indexUrl, nil)
+	if err != nil {
+		err = fmt.Errorf("Invalid url %s: %w", indexUrl, err)
+		return
+	}
+	if hasCache {
+		if len(cached.ETag) > 0 {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if len(cached.LastModified) > 0 {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	fallback := func(cause error) {
+		if hasCache {
+			waterlog.Warnf("Failed to fetch %s, using cached index from %s: %s\n", indexUrl, cached.Fetched.Format(time.DateTime), cause)
+			err = nil
+		} else {
+			err = fmt.Errorf("Failed to fetch %s: %w", indexUrl, cause)
+		}
+	}
+
+	client := http.Client{Timeout: remote.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		fallback(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && hasCache {
+		waterlog.Debugf("FetchRemote: cached index of %s is up to date\n", name)
+		cached.Fetched = time.Now()
+		err = writeCacheMeta(metaPath, cached)
+		return
+	} else if resp.StatusCode != http.StatusOK {
+		fallback(fmt.Errorf("server responded with %s", resp.Status))
+		return
+	}
+
+	var want string
+	if h != nil {
+		if want, err = fetchChecksum(indexUrl, remote.Checksum, remote.Timeout); err != nil {
+			fallback(err)
+			return
+		}
+	}
+
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		err = fmt.Errorf("Failed to create cache directory %s: %w", dir, err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(dir, cacheIndexFile+".*")
+	if err != nil {
+		err = fmt.Errorf("Failed to create temp file in cache directory %s: %w", dir, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var w io.Writer = tmp
+	if h != nil {
+		w = io.MultiWriter(tmp, h)
+	}
+
+	bar := progress.NewBytes("Fetching "+name, resp.ContentLength)
+	size, err := io.Copy(w, bar.Reader(resp.Body))
+	bar.Done()
+	if err != nil {
+		err = fmt.Errorf("Failed to download %s: %w", indexUrl, err)
+		return
+	}
+
+	var sum string
+	if h != nil {
+		if sum = hex.EncodeToString(h.Sum(nil)); sum != want {
+			err = fmt.Errorf("Checksum mismatch for binary index from url %s: expected %s %s, got %s", indexUrl, remote.Checksum, want, sum)
+			return
+		}
+	}
+
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		err = fmt.Errorf("Failed to move downloaded index into cache: %w", err)
+		return
+	}
+
+	err = writeCacheMeta(metaPath, CachedRemote{
+		Name:         name,
+		URL:          indexUrl,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Checksum:     remote.Checksum,
+		Sum:          sum,
+		Size:         size,
+		Fetched:      time.Now(),
+	})
+	return
+}
+
+func writeCacheMeta(path string, cached CachedRemote) error {
+	raw, err := json.MarshalIndent(cached, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o644)
+}
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/getsolus/libeopkg/index"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// decompress returns a reader of the content of `r` decompressed with
+// `compression`, which is one of `xz`, `zstd`, `gzip` and `none`. When it's
+// `auto` or empty, the compression is detected by the magic bytes of `r`.
+//
+// The returned closer must be called once done with the reader.
+func decompress(r io.Reader, compression string) (res io.Reader, closer func(), err error) {
+	br := bufio.NewReader(r)
+	closer = func() {}
+
+	if compression == "auto" || len(compression) == 0 {
+		var magic []byte
+		magic, err = br.Peek(len(xzMagic))
+		if err != nil && err != io.EOF {
+			err = fmt.Errorf("Failed to read magic bytes: %w", err)
+			return
+		}
+		err = nil
+
+		switch {
+		case bytes.HasPrefix(magic, xzMagic):
+			compression = "xz"
+		case bytes.HasPrefix(magic, zstdMagic):
+			compression = "zstd"
+		case bytes.HasPrefix(magic, gzipMagic):
+			compression = "gzip"
+		default:
+			compression = "none"
+		}
+	}
+
+	switch compression {
+	case "xz":
+		res, err = xz.NewReader(br)
+	case "zstd":
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(br); err == nil {
+			res, closer = zr, zr.Close
+		}
+	case "gzip":
+		var gr *gzip.Reader
+		if gr, err = gzip.NewReader(br); err == nil {
+			res, closer = gr, func() { gr.Close() }
+		}
+	case "none":
+		res = br
+	default:
+		err = fmt.Errorf("unknown compression %s", compression)
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("Failed to create decompressor: %w", err)
+	}
+	return
+}
+
+// decodeEopkgIndex parses the packages of an eopkg index one by one as they
+// are read from `r`, so that the whole index never has to be held in memory.
+// `r` may be compressed with any format supported by decompress.
+func decodeEopkgIndex(r io.Reader, compression string) (pkgs []common.Package, err error) {
+	dr, closer, err := decompress(r, compression)
+	if err != nil {
+		return
+	}
+	defer closer()
+
+	dec := xml.NewDecoder(dr)
+	// Only `<Package>` directly under the root is a package, there are others
+	// like `<Obsoletes><Package>` in `<Distribution>`.
+	depth := 0
+	for {
+		var tok xml.Token
+		tok, err = dec.Token()
+		if err == io.EOF {
+			err = nil
+			return
+		} else if err != nil {
+			err = fmt.Errorf("Failed to decode index: %w", err)
+			return
+		}
+
+		switch t := tok.(type) {
+		case xml.EndElement:
+			depth--
+			continue
+		case xml.StartElement:
+			depth++
+			if depth != 2 || t.Name.Local != "Package" {
+				continue
+			}
+		default:
+			continue
+		}
+		start := tok.(xml.StartElement)
+		depth--
+
+		var ipkg index.Package
+		if err = dec.DecodeElement(&ipkg, &start); err != nil {
+			err = fmt.Errorf("Failed to decode package in index: %w", err)
+			return
+		}
+
+		var pkg common.Package
+		if pkg, err = common.ParseIndexPackage(ipkg); err != nil {
+			return
+		}
+		pkgs = append(pkgs, pkg)
+	}
+}
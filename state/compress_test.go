@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// testIndex is an eopkg index with two packages, and `<Package>` elements
+// nested deeper that are not packages.
+const testIndex = `<?xml version="1.0" encoding="utf-8"?>
+<PISI>
+  <Distribution>
+    <SourceName>Solus</SourceName>
+    <Obsoletes>
+      <Package>old-zlib</Package>
+    </Obsoletes>
+  </Distribution>
+  <Package>
+    <Name>zlib</Name>
+    <Source><Name>zlib</Name></Source>
+    <Provides><PkgConfig>zlib</PkgConfig></Provides>
+    <History><Update release="5"><Version>1.3</Version></Update></History>
+  </Package>
+  <Group>
+    <Package>not-a-package</Package>
+  </Group>
+  <Package>
+    <Name>zlib-devel</Name>
+    <Source><Name>zlib</Name></Source>
+    <RuntimeDependencies><Dependency release="5">zlib</Dependency></RuntimeDependencies>
+    <History><Update release="5"><Version>1.3</Version></Update></History>
+  </Package>
+</PISI>
+`
+
+func compressIndex(t *testing.T, compression string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch compression {
+	case "xz":
+		w, err = xz.NewWriter(&buf)
+	case "zstd":
+		w, err = zstd.NewWriter(&buf)
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	default:
+		return []byte(testIndex)
+	}
+	if err != nil {
+		t.Fatalf("Failed to create %s compressor: %s", compression, err)
+	}
+
+	if _, err = io.WriteString(w, testIndex); err != nil {
+		t.Fatalf("Failed to compress index with %s: %s", compression, err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Failed to compress index with %s: %s", compression, err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		compression string
+		err         bool
+	}{
+		{"detect xz", "xz", "auto", false},
+		{"detect zstd", "zstd", "auto", false},
+		{"detect gzip", "gzip", "", false},
+		{"detect plain", "none", "auto", false},
+		{"xz", "xz", "xz", false},
+		{"zstd", "zstd", "zstd", false},
+		{"plain", "none", "none", false},
+		{"wrong compression", "none", "xz", true},
+		{"unknown compression", "xz", "bzip2", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, closer, err := decompress(bytes.NewReader(compressIndex(t, tt.data)), tt.compression)
+			if tt.err {
+				if err == nil {
+					t.Error("decompress() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decompress() failed: %s", err)
+			}
+			defer closer()
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("Failed to read decompressed index: %s", err)
+			}
+			if string(got) != testIndex {
+				t.Errorf("decompress() read %q, want %q", got, testIndex)
+			}
+		})
+	}
+}
+
+func TestDecompressShortInput(t *testing.T) {
+	// Shorter than any magic bytes
+	r, closer, err := decompress(bytes.NewReader([]byte("<a")), "auto")
+	if err != nil {
+		t.Fatalf("decompress() failed: %s", err)
+	}
+	defer closer()
+
+	if got, _ := io.ReadAll(r); string(got) != "<a" {
+		t.Errorf("decompress() read %q, want %q", got, "<a")
+	}
+}
+
+func TestDecodeEopkgIndex(t *testing.T) {
+	for _, compression := range []string{"xz", "zstd", "gzip", "none"} {
+		t.Run(compression, func(t *testing.T) {
+			pkgs, err := decodeEopkgIndex(bytes.NewReader(compressIndex(t, compression)), "auto")
+			if err != nil {
+				t.Fatalf("decodeEopkgIndex() failed: %s", err)
+			}
+
+			var names []string
+			for _, pkg := range pkgs {
+				names = append(names, pkg.Names...)
+			}
+			if want := []string{"zlib", "zlib-devel"}; !slices.Equal(names, want) {
+				t.Fatalf("decodeEopkgIndex() found %q, want %q", names, want)
+			}
+
+			zlib, devel := pkgs[0], pkgs[1]
+			if zlib.Source != "zlib" || zlib.Version != "1.3" || zlib.Release != 5 {
+				t.Errorf("zlib is %s at %s-%d, want zlib at 1.3-5", zlib.Source, zlib.Version, zlib.Release)
+			}
+			if want := []string{"name(zlib)", "pkgconfig(zlib)"}; !slices.Equal(zlib.Provides, want) {
+				t.Errorf("zlib provides %q, want %q", zlib.Provides, want)
+			}
+			if want := []string{"zlib"}; !slices.Equal(devel.LinkDeps, want) {
+				t.Errorf("zlib-devel links against %q, want %q", devel.LinkDeps, want)
+			}
+		})
+	}
+}
+
+func TestDecodeEopkgIndexBroken(t *testing.T) {
+	broken := testIndex[:len(testIndex)/2]
+	if _, err := decodeEopkgIndex(bytes.NewReader([]byte(broken)), "none"); err == nil {
+		t.Error("decodeEopkgIndex() of a truncated index succeeded")
+	}
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/getsolus/libeopkg/archive"
+)
+
+// LoadEopkgDir loads the `.eopkg` packages in the directory `path`, such as
+// the local repository that our builders produce. The metadata of the
+// packages are read in parallel.
+//
+// Delta packages are skipped. When there are multiple releases of the same
+// package, only the latest one is kept.
+func LoadEopkgDir(path string) (state *BinaryState, err error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to read eopkg directory %s: %w", path, err)
+		return
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".eopkg") || strings.HasSuffix(name, ".delta.eopkg") {
+			continue
+		}
+		files = append(files, filepath.Join(path, name))
+	}
+
+	pkgs := make([]common.Package, len(files))
+	errs := make([]error, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				pkgs[idx], errs[idx] = loadEopkg(files[idx])
+			}
+		}()
+	}
+	for idx := range files {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	latest := make(map[string]int)
+	for idx, pkg := range pkgs {
+		if errs[idx] != nil {
+			err = errs[idx]
+			return
+		}
+
+		name := pkg.Names[0]
+		if other, ok := latest[name]; ok {
+			waterlog.Debugf("LoadEopkgDir: multiple releases of %s found: %d and %d\n", name, pkgs[other].Release, pkg.Release)
+			if pkgs[other].Release >= pkg.Release {
+				continue
+			}
+		}
+		latest[name] = idx
+	}
+
+	res := make([]common.Package, 0, len(latest))
+	for _, idx := range latest {
+		res = append(res, pkgs[idx])
+	}
+	slices.SortFunc(res, func(a, b common.Package) int {
+		return cmp.Compare(a.Names[0], b.Names[0])
+	})
+
+	state, err = newBinaryState(res)
+	return
+}
+
+func loadEopkg(path string) (pkg common.Package, err error) {
+	a, err := archive.OpenAll(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to read eopkg %s: %w", path, err)
+		return
+	}
+	defer a.Close()
+
+	pkg, err = common.ParseArchivePackage(a)
+	return
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
+// ParseOverlay returns the layers of an overlay tpath, i.e. the source paths
+// of `overlay:src:<path>,src:<path>,...`, in order.
+func ParseOverlay(tpath string) (layers []string, err error) {
+	rest, ok := strings.CutPrefix(tpath, "overlay:")
+	if !ok || len(rest) == 0 {
+		err = InvalidTPathError
+		return
+	}
+
+	for _, layer := range strings.Split(rest, ",") {
+		path, ok := strings.CutPrefix(layer, "src:")
+		if !ok || len(path) == 0 {
+			err = fmt.Errorf("Invalid overlay layer %q: only src: layers can be overlaid", layer)
+			return
+		}
+		layers = append(layers, path)
+	}
+	return
+}
+
+// LoadOverlay loads the source trees at `layers` as a single state. Earlier
+// layers override later ones per source name, so a work tree that only holds
+// the packages being changed can be laid over the full packages repository
+// and still get a complete dependency graph.
+//
+// The Root of each package is the layer it comes from. Build dependencies that
+// no layer provides may be satisfied by `fallback`, if it's not nil.
+func LoadOverlay(layers []string, fallback State) (state *SourceState, err error) {
+	var pkgs []common.Package
+	owner := make(map[string]string)
+	isGit := true
+
+	for _, layer := range layers {
+		var layerPkgs []common.Package
+		if layerPkgs, err = walkSource(layer); err != nil {
+			err = fmt.Errorf("Failed to load overlay layer %s: %w", layer, err)
+			return
+		}
+		isGit = isGit && utils.PathExists(filepath.Join(layer, ".git"))
+
+		// Sources are only overridden by other layers, a layer may well have
+		// multiple packages (e.g. split stone packages) of the same source.
+		seen := make(map[string]bool)
+		for _, pkg := range layerPkgs {
+			if other, ok := owner[pkg.Source]; ok && !seen[pkg.Source] {
+				waterlog.Debugf("LoadOverlay: %s from %s is overridden by %s\n", pkg.Source, layer, other)
+				continue
+			}
+			owner[pkg.Source] = layer
+			seen[pkg.Source] = true
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	state = newSourceState(pkgs, fallback)
+	state.isGit = isGit
+	return
+}
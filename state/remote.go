@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GZGavinZhao/autobuild/config"
+)
+
+var (
+	// Remotes are the named remote repositories that `repo:` tpaths can
+	// refer to, usually loaded from the global config file. Names that are
+	// not here refer to the official Solus repository of that name.
+	Remotes = map[string]config.RemoteConfig{}
+)
+
+func remoteFor(name string) config.RemoteConfig {
+	if remote, ok := Remotes[name]; ok {
+		return remote.WithDefaults()
+	}
+	return config.DefaultRemote(name)
+}
+
+// remoteIndexUrl returns the URL of the index file of `remote`.
+func remoteIndexUrl(remote config.RemoteConfig) string {
+	return strings.TrimSuffix(remote.URL, "/") + "/" + remote.Index
+}
+
+// openUrl opens `rawUrl` for reading. Besides `http://` and `https://`,
+// `file://` URLs are supported so that a local directory can stand in for a
+// remote repository.
+func openUrl(rawUrl string, timeout time.Duration) (body io.ReadCloser, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		err = fmt.Errorf("Invalid url %s: %w", rawUrl, err)
+		return
+	}
+
+	if u.Scheme == "file" {
+		body, err = os.Open(u.Path)
+		return
+	}
+
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Get(rawUrl)
+	if err != nil {
+		err = fmt.Errorf("Failed to fetch %s: %w", rawUrl, err)
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("Failed to fetch %s: server responded with %s", rawUrl, resp.Status)
+		return
+	}
+
+	body = resp.Body
+	return
+}
+
+// newChecksumHash returns the hash for the `checksum` kind of a remote, or nil
+// if the checksum shouldn't be verified.
+func newChecksumHash(checksum string) (h hash.Hash, err error) {
+	switch checksum {
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "none", "":
+	default:
+		err = fmt.Errorf("unknown checksum kind %s", checksum)
+	}
+	return
+}
+
+// fetchChecksum fetches the published checksum of `indexUrl`, which is the
+// first field of `<indexUrl>.<checksum>sum`.
+func fetchChecksum(indexUrl string, checksum string, timeout time.Duration) (sum string, err error) {
+	sumUrl := fmt.Sprintf("%s.%ssum", indexUrl, checksum)
+	body, err := openUrl(sumUrl, timeout)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(body, 4096))
+	if err != nil {
+		err = fmt.Errorf("Failed to read checksum from %s: %w", sumUrl, err)
+		return
+	}
+
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		err = fmt.Errorf("Checksum file %s is empty", sumUrl)
+		return
+	}
+
+	sum = strings.ToLower(fields[0])
+	return
+}
+
+// LoadEopkgRepo loads the index of the remote repository `name`, verifying it
+// against the published checksum if the remote asks to.
+//
+// Indexes fetched over the network go through the cache, see FetchRemote.
+func LoadEopkgRepo(name string) (state *BinaryState, err error) {
+	remote := remoteFor(name)
+	indexUrl := remoteIndexUrl(remote)
+
+	if strings.HasPrefix(indexUrl, "file://") {
+		state, err = loadIndexUrl(name, remote, indexUrl)
+		return
+	}
+
+	path, err := FetchRemote(name)
+	if err != nil {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to open cached binary index of %s: %w", name, err)
+		return
+	}
+	defer file.Close()
+
+	pkgs, err := decodeEopkgIndex(file, remote.Compression)
+	if err != nil {
+		err = fmt.Errorf("Failed to decode cached binary index of %s at %s: %w", name, path, err)
+		return
+	}
+
+	state, err = newIndexState(pkgs)
+	return
+}
+
+// loadIndexUrl loads the index at `indexUrl` directly, without caching it.
+func loadIndexUrl(name string, remote config.RemoteConfig, indexUrl string) (state *BinaryState, err error) {
+	h, err := newChecksumHash(remote.Checksum)
+	if err != nil {
+		err = fmt.Errorf("Invalid remote %s: %w", name, err)
+		return
+	}
+
+	var want string
+	if h != nil {
+		if want, err = fetchChecksum(indexUrl, remote.Checksum, remote.Timeout); err != nil {
+			return
+		}
+	}
+
+	body, err := openUrl(indexUrl, remote.Timeout)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+
+	var r io.Reader = body
+	if h != nil {
+		r = io.TeeReader(body, h)
+	}
+
+	pkgs, err := decodeEopkgIndex(r, remote.Compression)
+	if err != nil {
+		err = fmt.Errorf("Failed to decode binary index from url %s: %w", indexUrl, err)
+		return
+	}
+
+	if h != nil {
+		// The decoder may stop before the end of the file, but the checksum
+		// covers all of it.
+		if _, err = io.Copy(io.Discard, r); err != nil {
+			err = fmt.Errorf("Failed to read binary index from url %s: %w", indexUrl, err)
+			return
+		}
+
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			err = fmt.Errorf("Checksum mismatch for binary index from url %s: expected %s %s, got %s", indexUrl, remote.Checksum, want, got)
+			return
+		}
+	}
+
+	state, err = newIndexState(pkgs)
+	return
+}
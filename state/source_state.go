@@ -15,6 +15,7 @@ import (
 	"github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/common"
 	"github.com/GZGavinZhao/autobuild/config"
+	"github.com/GZGavinZhao/autobuild/progress"
 	"github.com/GZGavinZhao/autobuild/stone"
 	"github.com/GZGavinZhao/autobuild/utils"
 	"github.com/charlievieth/fastwalk"
@@ -30,7 +31,11 @@ type SourceState struct {
 	depGraph    *graph.Immutable
 	pvdToPkgIdx map[string]int
 	srcToPkgIds map[string][]int
+	unresolved  map[int][]string
 	isGit       bool
+	// fallback satisfies the build dependencies that no package provides,
+	// if it's not nil.
+	fallback State
 }
 
 func (s *SourceState) Packages() []common.Package {
@@ -53,12 +58,24 @@ func (s *SourceState) IsGit() bool {
 	return s.isGit
 }
 
-func (s *SourceState) buildGraph() {
+// Unresolved returns the build dependencies of each package that are provided
+// by neither the source state nor its fallback state, if any.
+func (s *SourceState) Unresolved() map[int][]string {
+	return s.unresolved
+}
+
+// buildGraph builds the dependency graph between the packages. Build
+// dependencies that no package provides may be satisfied by `fallback`, if
+// it's not nil.
+func (s *SourceState) buildGraph(fallback State) {
 	g := graph.New(len(s.packages))
+	s.unresolved = make(map[int][]string)
 
 	for pkgIdx, pkg := range s.packages {
+		s.packages[pkgIdx].Resolved = true
+
 		for _, dep := range pkg.BuildDeps {
-			depIdx, depFound := s.pvdToPkgIdx[dep]
+			depIdx, depFound := LookupProvider(s, dep)
 
 			// Check if this package or any of its providers are requested to be
 			// ignored
@@ -71,7 +88,16 @@ func (s *SourceState) buildGraph() {
 			}
 
 			if !depFound {
-				waterlog.Warnf("Dependency %s of package %s is not found!\n", dep, pkg.Show(true, false))
+				if fallback == nil {
+					waterlog.Warnf("Dependency %s of package %s is not found!\n", dep, pkg.Show(true, false))
+				} else if PackageExists(fallback, dep) || PackageExists(fallback, fmt.Sprintf("name(%s)", dep)) {
+					waterlog.Debugf("Dependency %s of package %s is satisfied by the fallback state\n", dep, pkg.Show(true, false))
+					continue
+				} else {
+					waterlog.Errorf("Dependency %s of package %s is not found, not even in the fallback state!\n", dep, pkg.Show(true, false))
+				}
+				s.packages[pkgIdx].Resolved = false
+				s.unresolved[pkgIdx] = append(s.unresolved[pkgIdx], dep)
 			} else if pkgIdx != depIdx {
 				g.Add(depIdx, pkgIdx)
 			}
@@ -81,20 +107,28 @@ func (s *SourceState) buildGraph() {
 	s.depGraph = graph.Sort(g)
 }
 
-func LoadSource(path string) (state *SourceState, err error) {
-	state = &SourceState{}
-	state.pvdToPkgIdx = make(map[string]int)
-	state.srcToPkgIds = make(map[string][]int)
-
-	if utils.PathExists(filepath.Join(path, ".git")) {
-		state.isGit = true
+// LoadSource loads the recipes under `path`. Build dependencies that no recipe
+// provides may be satisfied by `fallback`, if it's not nil.
+func LoadSource(path string, fallback State) (state *SourceState, err error) {
+	pkgs, err := walkSource(path)
+	if err != nil {
+		return
 	}
 
+	state = newSourceState(pkgs, fallback)
+	state.isGit = utils.PathExists(filepath.Join(path, ".git"))
+	return
+}
+
+// walkSource parses all the recipes under `path`.
+func walkSource(path string) (packages []common.Package, err error) {
 	walkConf := fastwalk.Config{
 		Follow: false,
 	}
 	_ = walkConf
 	var mutex sync.Mutex
+	bar := progress.NewCount("Parsing "+path, "recipes")
+	defer bar.Done()
 
 	// err = filepath.WalkDir(path, func(pkgpath string, d fs.DirEntry, err error) error {
 	err = fastwalk.Walk(&walkConf, path, func(pkgpath string, d fs.DirEntry, err error) error {
@@ -148,15 +182,22 @@ func LoadSource(path string) (state *SourceState, err error) {
 		}
 
 		mutex.Lock()
-		state.packages = append(state.packages, pkgs...)
+		packages = append(packages, pkgs...)
 		mutex.Unlock()
+		bar.Add(1)
 
 		return filepath.SkipDir
 	})
 
-	if err != nil {
-		return
-	}
+	return
+}
+
+// newSourceState indexes `pkgs` by source and provider and builds the
+// dependency graph between them, see buildGraph.
+func newSourceState(pkgs []common.Package, fallback State) (state *SourceState) {
+	state = &SourceState{packages: pkgs, fallback: fallback}
+	state.pvdToPkgIdx = make(map[string]int)
+	state.srcToPkgIds = make(map[string][]int)
 
 	slices.SortFunc(state.packages, func(a, b common.Package) int {
 		if a.Source == b.Source {
@@ -192,6 +233,6 @@ func LoadSource(path string) (state *SourceState, err error) {
 	}
 
 	// fmt.Println("result:", state)
-	state.buildGraph()
+	state.buildGraph(fallback)
 	return
 }
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/common"
@@ -17,7 +18,7 @@ import (
 )
 
 var (
-	InvalidTPathError error = errors.New("Invalid tpath! Must be in the form \"[src|bin|repo]:path\"!")
+	InvalidTPathError error = errors.New("Invalid tpath! Must be in the form \"[src|bin|dir|repo]:path\" or \"overlay:src:path,src:path,...\"!")
 )
 
 type State interface {
@@ -34,8 +35,19 @@ func GetSourceIds(s State, name string) []int {
 	return s.SrcToPkgIds()[name]
 }
 
+// LookupProvider returns the index of the package that satisfies the
+// dependency `pvd`, see common.ProviderCandidates.
+func LookupProvider(s State, pvd string) (idx int, ok bool) {
+	for _, candidate := range common.ProviderCandidates(pvd) {
+		if idx, ok = s.PvdToPkgIdx()[candidate]; ok {
+			return
+		}
+	}
+	return
+}
+
 func GetPackage(s State, pvd string) (common.Package, int) {
-	idx, ok := s.PvdToPkgIdx()[pvd]
+	idx, ok := LookupProvider(s, pvd)
 	if !ok {
 		return common.Package{}, -1
 	} else {
@@ -44,35 +56,129 @@ func GetPackage(s State, pvd string) (common.Package, int) {
 }
 
 func GetPackageIdx(s State, pvd string) int {
-	return s.PvdToPkgIdx()[pvd]
+	idx, _ := LookupProvider(s, pvd)
+	return idx
 }
 
 func PackageExists(s State, pvd string) bool {
-	_, ok := s.PvdToPkgIdx()[pvd]
+	_, ok := LookupProvider(s, pvd)
 	return ok
 }
 
+// SonamesKnown returns whether `s` knows the `soname(...)` providers of the
+// packages it depends on. Binary indexes don't list the files of packages, so
+// states loaded from one, and source states whose build dependencies fall back
+// to one, don't.
+func SonamesKnown(s State) bool {
+	switch s := s.(type) {
+	case *BinaryState:
+		return !s.index
+	case *SourceState:
+		return s.fallback == nil || SonamesKnown(s.fallback)
+	default:
+		return true
+	}
+}
+
+// ReverseDeps returns the subpackage that provides `pvd` and the packages that
+// depend on it.
+//
+// When `linkOnly` is true, only the dependencies detected from the built
+// artefacts (see common.Package.LinkDeps) are considered, which answers
+// questions like "who links against libfoo.so.3".
+func ReverseDeps(s State, pvd string, linkOnly bool) (sub string, res []common.Package, err error) {
+	pkg, idx := GetPackage(s, pvd)
+	if idx == -1 && common.ParseProvider(pvd).Kind == "soname" && !SonamesKnown(s) {
+		err = fmt.Errorf("Unable to find provider %s: binary indexes don't list the shared libraries of packages, use a src: or dir: tpath without an index fallback instead", pvd)
+		return
+	} else if idx == -1 {
+		// Binary states only know about `name(...)` providers
+		if pkg, idx = GetPackage(s, fmt.Sprintf("name(%s)", pvd)); idx == -1 {
+			err = fmt.Errorf("Unable to find provider %s", pvd)
+			return
+		}
+	}
+
+	subs := make([]string, 0, len(pkg.SubProvides))
+	for name := range pkg.SubProvides {
+		subs = append(subs, name)
+	}
+	slices.Sort(subs)
+	for _, name := range subs {
+		if name == pvd || slices.Contains(pkg.SubProvides[name], pvd) {
+			sub = name
+			break
+		}
+	}
+	if len(sub) == 0 && len(pkg.Names) > 0 {
+		sub = pkg.Names[0]
+	}
+
+	wanted := []string{pvd, sub, fmt.Sprintf("name(%s)", sub)}
+	dependsOn := func(deps []string) bool {
+		for _, dep := range deps {
+			// Dependencies from stone manifests carry an architecture
+			for _, candidate := range common.ProviderCandidates(dep) {
+				if slices.Contains(wanted, candidate) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for otherIdx, other := range s.Packages() {
+		if otherIdx == idx {
+			continue
+		}
+
+		if dependsOn(other.LinkDeps) || (!linkOnly && dependsOn(other.BuildDeps)) {
+			res = append(res, other)
+		}
+	}
+
+	return
+}
+
 func ValidTPath(tpath string) bool {
+	if strings.HasPrefix(tpath, "overlay:") {
+		_, err := ParseOverlay(tpath)
+		return err == nil
+	}
+
 	splitted := strings.Split(tpath, ":")
 
 	if len(splitted) > 2 {
 		return false
 	}
 
-	return slices.Contains([]string{"src", "bin", "repo"}, splitted[0])
+	return slices.Contains([]string{"src", "bin", "dir", "eopkgs", "repo"}, splitted[0])
 }
 
-func LoadState(tpath string) (state State, err error) {
+// LoadState loads the state at `tpath`. The build dependencies of source
+// states that no recipe provides may be satisfied by `fallback`, if it's not
+// nil.
+func LoadState(tpath string, fallback State) (state State, err error) {
 	if !ValidTPath(tpath) {
 		err = InvalidTPathError
 		return
 	}
 
+	if strings.HasPrefix(tpath, "overlay:") {
+		var layers []string
+		if layers, err = ParseOverlay(tpath); err == nil {
+			state, err = LoadOverlay(layers, fallback)
+		}
+		return
+	}
+
 	splitted := strings.Split(tpath, ":")
 	if splitted[0] == "src" {
-		state, err = LoadSource(splitted[1])
+		state, err = LoadSource(splitted[1], fallback)
 	} else if splitted[0] == "bin" {
 		state, err = LoadBinary(splitted[1])
+	} else if splitted[0] == "dir" || splitted[0] == "eopkgs" {
+		state, err = LoadEopkgDir(splitted[1])
 	} else {
 		state, err = LoadEopkgRepo(splitted[1])
 	}
@@ -200,3 +306,58 @@ func QueryOrder(state State, choose func(int) bool) (res [][]common.Package, err
 	}
 	return
 }
+
+// QuerySchedule schedules building the chosen packages on `builders` parallel
+// builders, where building a package takes `duration(pkg)`, so that they are
+// all built as early as possible. See utils.CriticalPathSchedule.
+//
+// The dependency graph between the chosen packages must not have cycles, so
+// call QueryOrder first.
+func QuerySchedule(state State, choose func(int) bool, duration func(common.Package) time.Duration, builders int) utils.Schedule {
+	lifted := utils.LiftGraph(state.DepGraph(), choose)
+
+	var nodes []int
+	for node := 0; node < lifted.Order(); node++ {
+		if choose(node) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	weights := make(map[int]time.Duration)
+	for _, node := range nodes {
+		weights[node] = duration(state.Packages()[node])
+	}
+
+	return utils.CriticalPathSchedule(lifted, nodes, func(node int) time.Duration { return weights[node] }, builders)
+}
+
+// NodesOf returns the indices of the nodes of `pkg` in `state`, i.e. of the
+// package itself, or of the split nodes that it was merged from.
+func NodesOf(state State, pkg common.Package) (ids []int) {
+	for _, idx := range GetSourceIds(state, pkg.Source) {
+		names := state.Packages()[idx].Names
+		if len(names) > 0 && slices.Contains(pkg.Names, names[0]) {
+			ids = append(ids, idx)
+		}
+	}
+	return
+}
+
+// Blocked returns the chosen packages that depend on any of `failed`, directly
+// or through other packages, mapped to the package of `failed` that they are
+// blocked by. Packages blocked by more than one are mapped to the first of
+// them.
+func Blocked(state State, choose func(int) bool, failed []int) (blocked map[int]int) {
+	lifted := graph.Sort(utils.LiftGraph(state.DepGraph(), choose))
+
+	blocked = make(map[int]int)
+	for _, root := range failed {
+		utils.BFSWithDepth(lifted, root, func(node int, depth int) bool {
+			if _, ok := blocked[node]; !ok && node != root && choose(node) && !slices.Contains(failed, node) {
+				blocked[node] = root
+			}
+			return false
+		})
+	}
+	return
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+// Package stats keeps track of how long packages take to build, so that
+// builds can be scheduled to finish as early as possible.
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// keepBuilds is the number of recorded builds kept per source.
+	keepBuilds = 5
+)
+
+// Build is a finished build of a source recipe.
+type Build struct {
+	Source   string    `yaml:"source"`
+	Started  time.Time `yaml:"started"`
+	Finished time.Time `yaml:"finished"`
+}
+
+func (b Build) Duration() time.Duration {
+	return b.Finished.Sub(b.Started)
+}
+
+// Stats are the build durations known for each source recipe.
+type Stats struct {
+	// Durations are estimates given by hand, which take precedence over the
+	// recorded builds.
+	Durations map[string]time.Duration `yaml:"durations,omitempty"`
+	// Builds are the builds recorded by `autobuild push`, the latest last.
+	Builds []Build `yaml:"builds,omitempty"`
+}
+
+// DefaultPath returns where the stats file is looked up, i.e.
+// `$XDG_CACHE_HOME/autobuild/stats.yaml`.
+func DefaultPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "autobuild", "stats.yaml")
+}
+
+// Load loads the stats file at `path`. A missing file is not an error and
+// results in empty stats.
+func Load(path string) (s Stats, err error) {
+	raw, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+	defer raw.Close()
+
+	if err = yaml.NewDecoder(raw).Decode(&s); errors.Is(err, io.EOF) {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("Failed to decode stats file %s: %w", path, err)
+	}
+	return
+}
+
+// Save writes `s` to `path`, creating the parent directories if needed.
+func (s Stats) Save(path string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+
+	raw, err := yaml.Marshal(s)
+	if err != nil {
+		return
+	}
+	return os.WriteFile(path, raw, 0o644)
+}
+
+// Record adds a finished build, only keeping the latest few of each source.
+func (s *Stats) Record(build Build) {
+	s.Builds = append(s.Builds, build)
+
+	count := 0
+	for idx := len(s.Builds) - 1; idx >= 0; idx-- {
+		if s.Builds[idx].Source != build.Source {
+			continue
+		}
+		if count++; count > keepBuilds {
+			s.Builds = slices.Delete(s.Builds, idx, idx+1)
+		}
+	}
+}
+
+// RecordJob records the build of `source` by a job of `autobuild push`, which
+// was first seen building at `started` and finished at `finished`, the
+// `Finished` timestamp reported by the build server. Jobs that are not known
+// to have finished after they started are not recorded.
+func (s *Stats) RecordJob(source string, started time.Time, finished *time.Time) (ok bool) {
+	if started.IsZero() || finished == nil || !finished.After(started) {
+		return
+	}
+	s.Record(Build{Source: source, Started: started, Finished: *finished})
+	return true
+}
+
+// Estimate returns the estimated build duration of `source`: the one given by
+// hand if any, otherwise the median of its recorded builds. `ok` is false if
+// there is nothing known about `source`.
+func (s Stats) Estimate(source string) (d time.Duration, ok bool) {
+	if d, ok = s.Durations[source]; ok {
+		return
+	}
+
+	var durations []time.Duration
+	for _, build := range s.Builds {
+		if build.Source == source && build.Finished.After(build.Started) {
+			durations = append(durations, build.Duration())
+		}
+	}
+	if len(durations) == 0 {
+		return
+	}
+
+	slices.Sort(durations)
+	d, ok = durations[len(durations)/2], true
+	return
+}
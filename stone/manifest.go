@@ -1,41 +1,68 @@
 package stone
 
 import (
-	"errors"
 	"fmt"
-	"log/slog"
 	"os"
-	"slices"
+	"path/filepath"
 	"strings"
 
 	"github.com/GZGavinZhao/autobuild/common"
 	"github.com/GZGavinZhao/autobuild/config"
-	"github.com/GZGavinZhao/autobuild/utils"
 	"github.com/serpent-os/libstone-go"
 	"github.com/serpent-os/libstone-go/stone1"
 )
 
-var (
-	badProviders = [...]string{"soname(libz.so.1(x86))", "soname(libclang.so.15(x86_64))", "soname(libc.so.6(386))"}
-)
+// ManifestArch returns the architecture of a manifest from its file name, e.g.
+// `x86_64` for `manifest.x86_64.bin`.
+func ManifestArch(path string) string {
+	base := filepath.Base(path)
+	base = strings.TrimPrefix(base, "manifest.")
+	base = strings.TrimSuffix(base, ".bin")
+	return common.NormalizeArch(base)
+}
 
+// ParseManifest parses a single stone manifest. See ParseManifests.
 func ParseManifest(path string, abconfig config.AutobuildConfig) (cpkgs []common.Package, err error) {
-	// Prepare the `cpkg`-s that result from splitting.
-	// `cpkgs[0]` is the default cpkg to read info into.
-	// Starting from index 1 are the `cpkg` that are
-	// `split`-ted
-	cpkgs = append(cpkgs, common.Package{
-		Ignores: abconfig.Solver.Ignore,
-	})
-	nameToIdx := make(map[string]int)
-
-	for _, split := range abconfig.Solver.Split {
-		nameToIdx[split] = len(cpkgs)
-		cpkgs = append(cpkgs, common.Package{
-			Ignores: abconfig.Solver.Ignore,
-		})
+	return ParseManifests([]string{path}, abconfig)
+}
+
+// ParseManifests parses the manifests of every architecture that a stone
+// recipe has been built for, e.g. `manifest.x86_64.bin` and
+// `manifest.x86.bin` for recipes with emul32 enabled, and merges them into
+// the same set of packages.
+//
+// Architecture-dependent providers and dependencies are normalized, so that
+// 32-bit dependencies resolve against 32-bit providers only.
+func ParseManifests(paths []string, abconfig config.AutobuildConfig) (cpkgs []common.Package, err error) {
+	split := newSplitter(abconfig)
+
+	for _, path := range paths {
+		if err = readManifest(path, split); err != nil {
+			return
+		}
 	}
 
+	if len(paths) > 0 {
+		cpkgs, err = split.finish(filepath.Dir(paths[0]))
+	}
+	return
+}
+
+// normalizeManifestProvider normalizes a provider or dependency read from a
+// manifest of architecture `arch`, attaching `arch` to it if it doesn't
+// specify one. Every record of a manifest is for its architecture, so that
+// e.g. `name(foo)` of `manifest.x86.bin` only satisfies 32-bit dependencies.
+func normalizeManifestProvider(s string, arch string) string {
+	pvd := common.ParseProvider(s)
+	if len(pvd.Kind) > 0 && len(pvd.Arch) == 0 {
+		pvd.Arch = arch
+	}
+	return pvd.String()
+}
+
+func readManifest(path string, split *splitter) (err error) {
+	arch := ManifestArch(path)
+
 	// Open the manifest and read from it.
 	file, err := os.Open(path)
 	if err != nil {
@@ -73,6 +100,7 @@ func ParseManifest(path string, abconfig config.AutobuildConfig) (cpkgs []common
 		// We rely on the convention that the first field in meta is Name, so we
 		// know which splitted package this should belong to.
 		var cpkg *common.Package
+		var pkgName string
 		for rdr.NextRecord() {
 			switch record := rdr.Record.(type) {
 			case *stone1.MetaRecord:
@@ -84,28 +112,27 @@ func ParseManifest(path string, abconfig config.AutobuildConfig) (cpkgs []common
 				case stone1.Release:
 					cpkg.Release = int(record.Field.Value.(uint64))
 				case stone1.Depends:
-					dep := record.Field.String()
-					if !slices.Contains(badProviders[:], dep) {
-						if tos, ok := abconfig.Solver.Move[dep]; ok {
-							for _, to := range tos {
-								cpkgs[nameToIdx[to]].BuildDeps = append(cpkgs[nameToIdx[to]].BuildDeps, dep)
-							}
-						} else {
-							cpkg.BuildDeps = append(cpkg.BuildDeps, dep)
-						}
+					dep := normalizeManifestProvider(record.Field.String(), arch)
+					split.addDep(cpkg, dep)
+					if strings.HasPrefix(dep, "soname(") {
+						cpkg.LinkDeps = append(cpkg.LinkDeps, dep)
 					}
 				case stone1.Provides:
-					cpkg.Provides = append(cpkg.Provides, record.Field.String())
+					pvd := normalizeManifestProvider(record.Field.String(), arch)
+					cpkg.Provides = append(cpkg.Provides, pvd)
+					cpkg.SubProvides[pkgName] = append(cpkg.SubProvides[pkgName], pvd)
 				case stone1.Name:
-					pkgName := record.Field.String()
-					cpkg = &cpkgs[nameToIdx[pkgName]]
+					pkgName = record.Field.String()
+					cpkg = split.get(pkgName)
 
 					cpkg.Names = append(cpkg.Names, pkgName)
-					cpkg.Provides = append(cpkg.Provides, fmt.Sprintf("name(%s)", pkgName))
-					// Implcitily assume that `X-dbginfo` is provieded by
+					pvd := normalizeManifestProvider(fmt.Sprintf("name(%s)", pkgName), arch)
+					cpkg.Provides = append(cpkg.Provides, pvd)
+					cpkg.SubProvides[pkgName] = append(cpkg.SubProvides[pkgName], pvd)
+					// Implicitly assume that `X-dbginfo` is provided by
 					// package `X`.
-					if !strings.HasPrefix(pkgName, "-dbginfo") {
-						cpkg.Provides = append(cpkg.Provides, fmt.Sprintf("name(%s-dbginfo)", pkgName))
+					if !strings.HasSuffix(pkgName, "-dbginfo") {
+						cpkg.Provides = append(cpkg.Provides, normalizeManifestProvider(fmt.Sprintf("name(%s-dbginfo)", pkgName), arch))
 					}
 				}
 			default:
@@ -118,30 +145,5 @@ func ParseManifest(path string, abconfig config.AutobuildConfig) (cpkgs []common
 		}
 	}
 
-	for idx, cpkg := range cpkgs {
-		// Check if splitted packages are actually set when iterating through
-		// the subpackages.
-		if len(cpkg.Source) == 0 || len(cpkg.Version) == 0 || len(cpkg.Names) == 0 {
-			if idx == 0 {
-				err = errors.New("default package not set properly")
-				return
-			} else {
-				slog.Warn("Split seems to be unnecessary", "split", abconfig.Solver.Split[idx-1], "path", path)
-			}
-		}
-
-		// Sort dependencies for reproducibility
-		slices.Sort(cpkgs[idx].BuildDeps)
-		// fmt.Println(cpkgs[idx].BuildDeps)
-		cpkgs[idx].BuildDeps = utils.Uniq2(cpkgs[idx].BuildDeps)
-		// fmt.Println(cpkgs[idx].BuildDeps)
-
-		slices.Sort(cpkgs[idx].Provides)
-		cpkgs[idx].Provides = utils.Uniq2(cpkgs[idx].Provides)
-
-		slices.Sort(cpkgs[idx].Ignores)
-		cpkgs[idx].Ignores = utils.Uniq2(cpkgs[idx].Ignores)
-	}
-
 	return
 }
@@ -9,7 +9,7 @@ import (
 	// "fmt"
 	"path/filepath"
 	_ "regexp"
-	// "slices"
+	"slices"
 
 	_ "github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/common"
@@ -18,7 +18,11 @@ import (
 )
 
 func ParsePackage(path string, abconfig config.AutobuildConfig) (cpkgs []common.Package, err error) {
-	manifestPath := filepath.Join(path, "manifest.x86_64.bin")
+	manifestPaths, err := filepath.Glob(filepath.Join(path, "manifest.*.bin"))
+	if err != nil {
+		return
+	}
+	slices.Sort(manifestPaths)
 
 	// var abConfig config.AutobuildConfig
 	// for _, cfgBase := range []string{"autobuild.yaml", "autobuild.yml"} {
@@ -62,8 +66,8 @@ func ParsePackage(path string, abconfig config.AutobuildConfig) (cpkgs []common.
 		return
 	}
 
-	if utils.PathExists(manifestPath) {
-		if cpkgs, err = ParseManifest(manifestPath, abconfig); err != nil {
+	if len(manifestPaths) > 0 {
+		if cpkgs, err = ParseManifests(manifestPaths, abconfig); err != nil {
 			return
 		}
 
@@ -71,29 +75,12 @@ func ParsePackage(path string, abconfig config.AutobuildConfig) (cpkgs []common.
 		// 	err = fmt.Errorf("Manifest and stone.yml name mismatch: manifest has %s, stone.yml has %s", cpkg.Name, spkg.Name)
 		// 	return
 		// }
-	} else {
-		// TODO: the below is much more incomplete than the .bin parsing.
-		// We may need to fallback to `.yml` parsing in the case of inspecting
-		// build order before a package is build.
-		cpkg := common.Package{
-			Path:      stonePath,
-			Names:     []string{spkg.Name},
-			Source:    spkg.Name,
-			Version:   spkg.Version,
-			Release:   spkg.Release,
-			BuildDeps: append(spkg.BuildDeps, spkg.CheckDeps...),
-			Synced:    false,
-		}
-
-		cpkg.BuildDeps = append(cpkg.BuildDeps, spkg.CollectRunDeps()...)
-
-		if spkg.Toolchain == "clang" {
-			cpkg.BuildDeps = append(cpkg.BuildDeps, "llvm-clang-devel")
-		} else if spkg.Toolchain == "gnu" {
-			cpkg.BuildDeps = append(cpkg.BuildDeps, "gcc-devel")
-		}
+	} else if cpkgs, err = ParseRecipe(path, spkg, abconfig); err != nil {
+		return
+	}
 
-		cpkgs = append(cpkgs, cpkg)
+	for i := range cpkgs {
+		cpkgs[i].Path = path
 	}
 
 	// slices.Sort(cpkg.BuildDeps)
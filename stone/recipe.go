@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package stone
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/config"
+)
+
+var (
+	pcPathRe     = regexp.MustCompile(`^/usr/(lib|lib32|lib64|share)/pkgconfig/([^/*?\[]+)\.pc$`)
+	sonamePathRe = regexp.MustCompile(`^/usr/(lib|lib32|lib64)/([^/*?\[]+?\.so\.[0-9]+)([.*][^/]*)?$`)
+	binPathRe    = regexp.MustCompile(`^/usr/bin/([^/*?\[]+)$`)
+)
+
+// ParseRecipe builds the packages of a stone recipe from `stone.yaml` alone.
+// It is used when the recipe has not been built yet, i.e. there is no
+// manifest to read the precise providers and dependencies from.
+//
+// Providers other than `name(...)` are guessed from the `paths` of each
+// subpackage, so they are only as good as the paths listed in the recipe.
+func ParseRecipe(path string, spkg StoneYML, abconfig config.AutobuildConfig) (cpkgs []common.Package, err error) {
+	split := newSplitter(abconfig)
+
+	addSubPackage := func(name string) *common.Package {
+		cpkg := split.get(name)
+		cpkg.Path = path
+		cpkg.Source = spkg.Name
+		cpkg.Version = spkg.Version
+		cpkg.Release = spkg.Release
+
+		cpkg.Names = append(cpkg.Names, name)
+		cpkg.Provides = append(cpkg.Provides, fmt.Sprintf("name(%s)", name))
+		cpkg.SubProvides[name] = append(cpkg.SubProvides[name], fmt.Sprintf("name(%s)", name))
+		// Implicitly assume that `X-dbginfo` is provided by package `X`.
+		if !strings.HasSuffix(name, "-dbginfo") {
+			cpkg.Provides = append(cpkg.Provides, fmt.Sprintf("name(%s-dbginfo)", name))
+		}
+		return cpkg
+	}
+
+	main := addSubPackage(spkg.Name)
+	for _, dep := range spkg.BuildDeps {
+		split.addDep(main, normalizeDep(spkg.Expand(dep)))
+	}
+	for _, dep := range spkg.CheckDeps {
+		split.addDep(main, normalizeDep(spkg.Expand(dep)))
+	}
+	for _, dep := range spkg.RunDeps {
+		split.addDep(main, normalizeDep(spkg.Expand(dep)))
+	}
+
+	if spkg.Toolchain == "clang" {
+		split.addDep(main, normalizeDep("llvm-clang-devel"))
+	} else if spkg.Toolchain == "gnu" {
+		split.addDep(main, normalizeDep("gcc-devel"))
+	}
+
+	for _, subpkgs := range spkg.SubPackages {
+		for rawName, subpkg := range subpkgs {
+			name := spkg.Expand(rawName)
+
+			var cpkg *common.Package
+			if name == spkg.Name {
+				cpkg = main
+			} else {
+				cpkg = addSubPackage(name)
+			}
+
+			for _, dep := range subpkg.RunDeps {
+				split.addDep(cpkg, normalizeDep(spkg.Expand(dep)))
+			}
+			for _, p := range subpkg.Paths {
+				provides := guessProvides(spkg.Expand(p))
+				cpkg.Provides = append(cpkg.Provides, provides...)
+				cpkg.SubProvides[name] = append(cpkg.SubProvides[name], provides...)
+			}
+		}
+	}
+
+	cpkgs, err = split.finish(path)
+	return
+}
+
+// normalizeDep turns a bare package name into the `name(...)` provider form
+// used by stone manifests. Dependencies already in the provider form are
+// normalized with common.NormalizeProvider.
+func normalizeDep(dep string) string {
+	pvd := common.ParseProvider(dep)
+	if len(pvd.Kind) == 0 {
+		pvd.Kind = "name"
+	}
+	return pvd.String()
+}
+
+// guessProvides guesses the providers that a file path listed in `stone.yaml`
+// would generate once built. Paths containing globs in the relevant part are
+// skipped, because we can't know what they would expand to.
+func guessProvides(p string) (provides []string) {
+	if match := pcPathRe.FindStringSubmatch(p); match != nil {
+		if match[1] == "lib32" {
+			provides = append(provides, fmt.Sprintf("pkgconfig32(%s)", match[2]))
+		} else {
+			provides = append(provides, fmt.Sprintf("pkgconfig(%s)", match[2]))
+		}
+	} else if match := sonamePathRe.FindStringSubmatch(p); match != nil {
+		if match[1] == "lib32" {
+			provides = append(provides, fmt.Sprintf("soname(%s(x86))", match[2]))
+		} else {
+			provides = append(provides, fmt.Sprintf("soname(%s(x86_64))", match[2]))
+		}
+	} else if match := binPathRe.FindStringSubmatch(p); match != nil {
+		provides = append(provides, fmt.Sprintf("binary(%s)", match[1]))
+	}
+
+	return
+}
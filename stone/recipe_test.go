@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package stone
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGuessProvides(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		provides []string
+	}{
+		{"pkgconfig", "/usr/lib/pkgconfig/zlib.pc", []string{"pkgconfig(zlib)"}},
+		{"lib64 pkgconfig", "/usr/lib64/pkgconfig/zlib.pc", []string{"pkgconfig(zlib)"}},
+		{"32bit pkgconfig", "/usr/lib32/pkgconfig/zlib.pc", []string{"pkgconfig32(zlib)"}},
+		{"arch-independent pkgconfig", "/usr/share/pkgconfig/xproto.pc", []string{"pkgconfig(xproto)"}},
+		{"pkgconfig glob", "/usr/lib/pkgconfig/*.pc", nil},
+
+		{"soname", "/usr/lib/libz.so.1", []string{"soname(libz.so.1(x86_64))"}},
+		{"soname with glob", "/usr/lib/libz.so.1.*", []string{"soname(libz.so.1(x86_64))"}},
+		{"fully versioned soname", "/usr/lib/libz.so.1.3.1", []string{"soname(libz.so.1(x86_64))"}},
+		{"lib64 soname", "/usr/lib64/libz.so.1", []string{"soname(libz.so.1(x86_64))"}},
+		{"32bit soname", "/usr/lib32/libz.so.1", []string{"soname(libz.so.1(x86))"}},
+		{"non-lib soname", "/usr/lib/ld-linux-x86-64.so.2", []string{"soname(ld-linux-x86-64.so.2(x86_64))"}},
+		{"32bit non-lib soname", "/usr/lib32/ld-linux.so.2", []string{"soname(ld-linux.so.2(x86))"}},
+		{"unversioned library", "/usr/lib/libz.so", nil},
+		{"soname glob", "/usr/lib/lib*.so.*", nil},
+		{"nested library", "/usr/lib/gstreamer-1.0/libgstcoreelements.so", nil},
+
+		{"binary", "/usr/bin/gzip", []string{"binary(gzip)"}},
+		{"binary glob", "/usr/bin/*", nil},
+		{"header", "/usr/include/zlib.h", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if provides := guessProvides(tt.path); !slices.Equal(provides, tt.provides) {
+				t.Errorf("guessProvides(%q) = %q, want %q", tt.path, provides, tt.provides)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package stone
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/config"
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
+// splitter distributes the subpackages of a stone recipe into the
+// `common.Package` nodes requested by the `split` and `move` solver options.
+//
+// `cpkgs[0]` is the default node to read info into. Starting from index 1 are
+// the nodes that are `split`-ted, in the same order as `Solver.Split`.
+type splitter struct {
+	cpkgs     []common.Package
+	nameToIdx map[string]int
+	abconfig  config.AutobuildConfig
+}
+
+func newSplitter(abconfig config.AutobuildConfig) *splitter {
+	s := &splitter{
+		nameToIdx: make(map[string]int),
+		abconfig:  abconfig,
+	}
+
+	s.cpkgs = append(s.cpkgs, common.Package{
+		Ignores:     slices.Clone(abconfig.Solver.Ignore),
+		Stage1:      slices.Clone(abconfig.Solver.Stage1),
+		SubProvides: make(map[string][]string),
+	})
+	for _, split := range abconfig.Solver.Split {
+		s.nameToIdx[split] = len(s.cpkgs)
+		s.cpkgs = append(s.cpkgs, common.Package{
+			Ignores:     slices.Clone(abconfig.Solver.Ignore),
+			Stage1:      slices.Clone(abconfig.Solver.Stage1),
+			SubProvides: make(map[string][]string),
+		})
+	}
+
+	return s
+}
+
+// get returns the node that the subpackage `name` belongs to.
+func (s *splitter) get(name string) *common.Package {
+	return &s.cpkgs[s.nameToIdx[name]]
+}
+
+// addDep adds `dep` to `cpkg`, unless it is requested to be moved to other
+// split nodes. Moves may leave out the architecture of `dep`.
+func (s *splitter) addDep(cpkg *common.Package, dep string) {
+	for _, candidate := range common.ProviderCandidates(dep) {
+		if tos, ok := s.abconfig.Solver.Move[candidate]; ok {
+			for _, to := range tos {
+				s.cpkgs[s.nameToIdx[to]].BuildDeps = append(s.cpkgs[s.nameToIdx[to]].BuildDeps, dep)
+			}
+			return
+		}
+	}
+	cpkg.BuildDeps = append(cpkg.BuildDeps, dep)
+}
+
+// finish validates and normalizes the nodes, then returns them.
+func (s *splitter) finish(path string) (cpkgs []common.Package, err error) {
+	cpkgs = s.cpkgs
+
+	for idx, cpkg := range cpkgs {
+		// Check if splitted packages are actually set when iterating through
+		// the subpackages.
+		if len(cpkg.Source) == 0 || len(cpkg.Version) == 0 || len(cpkg.Names) == 0 {
+			if idx == 0 {
+				err = errors.New("default package not set properly")
+				return
+			} else {
+				slog.Warn("Split seems to be unnecessary", "split", s.abconfig.Solver.Split[idx-1], "path", path)
+			}
+		}
+
+		// The same subpackage shows up once per manifest when there are
+		// multiple architectures, but the order of names matters.
+		var names []string
+		for _, name := range cpkg.Names {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		cpkgs[idx].Names = names
+
+		// Sort dependencies for reproducibility
+		slices.Sort(cpkgs[idx].BuildDeps)
+		cpkgs[idx].BuildDeps = utils.Uniq2(cpkgs[idx].BuildDeps)
+
+		slices.Sort(cpkgs[idx].Provides)
+		cpkgs[idx].Provides = utils.Uniq2(cpkgs[idx].Provides)
+
+		slices.Sort(cpkgs[idx].LinkDeps)
+		cpkgs[idx].LinkDeps = utils.Uniq2(cpkgs[idx].LinkDeps)
+
+		slices.Sort(cpkgs[idx].Ignores)
+		cpkgs[idx].Ignores = utils.Uniq2(cpkgs[idx].Ignores)
+	}
+
+	return
+}
@@ -5,21 +5,24 @@
 package stone
 
 import (
+	"os"
+	"regexp"
+	"strings"
+
 	"github.com/deckarep/golang-set/v2"
 	"gopkg.in/yaml.v3"
-	"os"
 )
 
 type SubPackage struct {
 	Summary     string   `yaml:"summary"`
 	Description string   `yaml:"description"`
-	RunDeps     []string   `yaml:"rundeps"`
+	RunDeps     []string `yaml:"rundeps"`
 	Paths       []string `yaml:"paths"`
 }
 
 type StoneYML struct {
 	Name        string                  `yaml:"name"`
-	Version     string                  `yaml:"string"`
+	Version     string                  `yaml:"version"`
 	Release     int                     `yaml:"release"`
 	RunDeps     []string                `yaml:"rundeps"`
 	BuildDeps   []string                `yaml:"builddeps"`
@@ -53,6 +56,62 @@ func (s *StoneYML) CollectRunDeps() (res []string) {
 	return set.ToSlice()
 }
 
+// macros are boulder's definitions of the macros commonly found in subpackage
+// names, rundeps and paths. They may refer to each other, and to `%(name)` and
+// `%(version)` of the recipe.
+var macros = map[string]string{
+	"prefix":         "/usr",
+	"bindir":         "%(prefix)/bin",
+	"sbindir":        "%(prefix)/sbin",
+	"includedir":     "%(prefix)/include",
+	"datadir":        "%(prefix)/share",
+	"localedir":      "%(datadir)/locale",
+	"infodir":        "%(datadir)/info",
+	"mandir":         "%(datadir)/man",
+	"docdir":         "%(datadir)/doc",
+	"vendordir":      "%(datadir)/defaults",
+	"completionsdir": "%(datadir)/bash-completion/completions",
+	"tmpfilesdir":    "%(prefix)/lib/tmpfiles.d",
+	"sysusersdir":    "%(prefix)/lib/sysusers.d",
+	"udevrulesdir":   "%(prefix)/lib/udev/rules.d",
+	"localstatedir":  "/var",
+	"sharedstatedir": "%(localstatedir)/lib",
+	"runstatedir":    "/run",
+	"sysconfdir":     "/etc",
+	"libsuffix":      "",
+	"libdir":         "%(prefix)/lib%(libsuffix)",
+	"libexecdir":     "%(libdir)/%(name)",
+}
+
+var macroRe = regexp.MustCompile(`%\((\w+)\)`)
+
+// Expand substitutes the macros commonly found in subpackage names, rundeps
+// and paths, such as `%(name)` and `%(libdir)`, see macros. Unknown macros are
+// left as-is.
+func (s *StoneYML) Expand(str string) string {
+	// Macros refer to each other only a few levels deep
+	for depth := 0; depth < 8 && strings.Contains(str, "%("); depth++ {
+		expanded := macroRe.ReplaceAllStringFunc(str, func(macro string) string {
+			switch key := macro[2 : len(macro)-1]; key {
+			case "name":
+				return s.Name
+			case "version":
+				return s.Version
+			default:
+				if value, ok := macros[key]; ok {
+					return value
+				}
+				return macro
+			}
+		})
+		if expanded == str {
+			break
+		}
+		str = expanded
+	}
+	return str
+}
+
 func Load(path string) (pkg StoneYML, err error) {
 	raw, err := os.Open(path)
 	if err != nil {
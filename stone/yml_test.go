@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package stone
+
+import (
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	spkg := StoneYML{Name: "zlib", Version: "1.3.1"}
+
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"no macros", "/usr/include/zlib.h", "/usr/include/zlib.h"},
+		{"name", "%(name)-devel", "zlib-devel"},
+		{"name and version", "%(name)-%(version)", "zlib-1.3.1"},
+		{"one level", "%(bindir)/gzip", "/usr/bin/gzip"},
+		{"two levels", "%(mandir)/man3/zlib.3", "/usr/share/man/man3/zlib.3"},
+		{"libdir", "%(libdir)/libz.so.*", "/usr/lib/libz.so.*"},
+		{"libexecdir", "%(libexecdir)/helper", "/usr/lib/zlib/helper"},
+		{"several macros", "%(libdir)/pkgconfig/%(name).pc", "/usr/lib/pkgconfig/zlib.pc"},
+		{"unknown macro", "%(nonexistent)/foo", "%(nonexistent)/foo"},
+		{"not a macro", "100%(", "100%("},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spkg.Expand(tt.str); got != tt.want {
+				t.Errorf("Expand(%q) = %q, want %q", tt.str, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/yourbasic/graph"
+)
+
+// Slot is when and where a node is scheduled to be built.
+type Slot struct {
+	Node    int
+	Builder int
+	Start   time.Duration
+	Finish  time.Duration
+}
+
+// Schedule is the result of CriticalPathSchedule.
+type Schedule struct {
+	// Slots are sorted by their start time.
+	Slots    []Slot
+	Makespan time.Duration
+	// CriticalPath is the chain of dependent nodes with the longest total
+	// duration, which no number of builders can finish faster than.
+	CriticalPath []int
+}
+
+// CriticalPathSchedule schedules building `nodes` of the DAG `g` on
+// `builders` parallel builders, where building node `v` takes `weight(v)`
+// and an edge `u -> v` means that `v` can only be built after `u`.
+//
+// It's a list scheduler that always starts the ready node with the longest
+// remaining path to the end of the graph first, so that the nodes on the
+// critical path are never waiting for a builder if it can be helped.
+func CriticalPathSchedule(g graph.Iterator, nodes []int, weight func(int) time.Duration, builders int) (res Schedule) {
+	if builders < 1 {
+		builders = 1
+	}
+
+	chosen := make(map[int]bool)
+	for _, node := range nodes {
+		chosen[node] = true
+	}
+
+	// The bottom level of a node is the longest duration from the start of
+	// its build to the end of the whole graph.
+	level := make(map[int]time.Duration)
+	next := make(map[int]int)
+	var bottom func(int) time.Duration
+	bottom = func(v int) time.Duration {
+		if l, ok := level[v]; ok {
+			return l
+		}
+
+		var longest time.Duration
+		next[v] = -1
+		g.Visit(v, func(w int, _ int64) (skip bool) {
+			if !chosen[w] {
+				return
+			}
+			if l := bottom(w); next[v] == -1 || l > longest || (l == longest && w < next[v]) {
+				longest, next[v] = l, w
+			}
+			return
+		})
+
+		level[v] = weight(v) + longest
+		return level[v]
+	}
+
+	indegree := make(map[int]int)
+	for _, v := range nodes {
+		bottom(v)
+		g.Visit(v, func(w int, _ int64) (skip bool) {
+			if chosen[w] {
+				indegree[w]++
+			}
+			return
+		})
+	}
+
+	// Critical path, starting from the source with the highest bottom level
+	start := -1
+	for _, v := range nodes {
+		if indegree[v] == 0 && (start == -1 || level[v] > level[start] || (level[v] == level[start] && v < start)) {
+			start = v
+		}
+	}
+	for v := start; v != -1; v = next[v] {
+		res.CriticalPath = append(res.CriticalPath, v)
+	}
+
+	byPriority := func(a, b int) int {
+		if c := cmp.Compare(level[b], level[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	}
+
+	var ready []int
+	for _, v := range nodes {
+		if indegree[v] == 0 {
+			ready = append(ready, v)
+		}
+	}
+
+	free := make([]time.Duration, builders)
+	var running []Slot
+	var now time.Duration
+	for len(ready) > 0 || len(running) > 0 {
+		slices.SortFunc(ready, byPriority)
+		for builder := range free {
+			if len(ready) == 0 {
+				break
+			}
+			if free[builder] > now {
+				continue
+			}
+
+			v := ready[0]
+			ready = ready[1:]
+			slot := Slot{Node: v, Builder: builder, Start: now, Finish: now + weight(v)}
+			free[builder] = slot.Finish
+			running = append(running, slot)
+			res.Slots = append(res.Slots, slot)
+		}
+
+		// Advance to the next time a build finishes
+		slices.SortFunc(running, func(a, b Slot) int {
+			return cmp.Compare(a.Finish, b.Finish)
+		})
+		if len(running) == 0 {
+			break
+		}
+		now = running[0].Finish
+		for len(running) > 0 && running[0].Finish == now {
+			done := running[0]
+			running = running[1:]
+			g.Visit(done.Node, func(w int, _ int64) (skip bool) {
+				if !chosen[w] {
+					return
+				}
+				if indegree[w]--; indegree[w] == 0 {
+					ready = append(ready, w)
+				}
+				return
+			})
+		}
+	}
+
+	for _, slot := range res.Slots {
+		res.Makespan = max(res.Makespan, slot.Finish)
+	}
+	return
+}